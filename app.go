@@ -4,13 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"sort"
+	"strings"
 	"time"
 
 	"github.com/pborman/uuid"
-	"k8s.io/client-go/1.4/kubernetes"
-	v1types "k8s.io/client-go/1.4/pkg/api/v1"
-	"k8s.io/client-go/1.4/rest"
+)
+
+var (
+	// ErrInvalidVersion is returned when asking for a release version below 1.
+	ErrInvalidVersion = errors.New("version cannot be below 1")
+	// ErrReleaseNotFound is returned when asking for a release version which is not in the ledger.
+	ErrReleaseNotFound = errors.New("release not found")
+	// ErrCollaboratorExists is returned when adding a user who can already access the app.
+	ErrCollaboratorExists = errors.New("user can already access this app")
+	// ErrCollaboratorNotFound is returned when removing a user who is not a collaborator.
+	ErrCollaboratorNotFound = errors.New("user is not a collaborator on this app")
 )
 
 type releaseLedger []*Release
@@ -27,14 +35,60 @@ type App struct {
 	Created time.Time     `json:"created"`
 	Updated time.Time     `json:"updated"`
 	Ledger  releaseLedger `json:"-"`
+	// Structure is the desired number of processes for each process type. Process types which
+	// are not listed run a single process.
+	Structure map[string]int `json:"structure"`
+	// Owner is the username of the user who created the app.
+	Owner string `json:"owner"`
+	// Collaborators are the usernames of the users the owner shared the app with.
+	Collaborators []string `json:"collaborators"`
+	// Domains are the hostnames the app's web processes are reachable at.
+	Domains []string `json:"domains"`
+	// Certs are the TLS certificates serving the app's domains over HTTPS.
+	Certs []*Cert `json:"-"`
+}
+
+// ScaleError is returned when an app cannot be scaled to the requested structure.
+type ScaleError struct {
+	Message string
+}
+
+func (e *ScaleError) Error() string {
+	return fmt.Sprintf("could not scale app: %s", e.Message)
+}
+
+// AppError is returned when an app ID cannot be used.
+type AppError struct {
+	ID      string
+	Message string
+}
+
+func (e *AppError) Error() string {
+	return fmt.Sprintf("invalid app %s: %s", e.ID, e.Message)
+}
+
+// ValidateAppID checks that id can name an app. Schedulers name resources after the app, such as
+// a Kubernetes namespace, so the ID must be a DNS label as per RFC 1123, and must not be one of
+// the names the cluster keeps for itself.
+func ValidateAppID(id string) error {
+	if !labelRegexp.MatchString(id) {
+		return &AppError{id, "must consist of at most 63 lower case letters, digits and hyphens, and must not start or end with a hyphen"}
+	}
+	if id == "default" || strings.HasPrefix(id, "kube-") {
+		return &AppError{id, "is reserved by the cluster"}
+	}
+	return nil
 }
 
-// NewApp creates a new application with the given ID. If no ID is supplied, one will be
-// automatically generated.
-func NewApp(id string) (*App, error) {
+// NewApp creates a new application with the given ID and prepares the scheduler for it. If no ID
+// is supplied, one will be automatically generated.
+func NewApp(id string, scheduler Scheduler) (*App, error) {
 	if id == "" {
 		id = generateAppName()
 	}
+	if err := ValidateAppID(id); err != nil {
+		return nil, err
+	}
 	app := &App{
 		UUID:    uuid.New(),
 		ID:      id,
@@ -43,24 +97,7 @@ func NewApp(id string) (*App, error) {
 	}
 	// create an initial release for the app
 	app.NewRelease(nil, nil)
-	// create a namespace for the app
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, err
-	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
-	}
-	namespace := &v1types.Namespace{
-		ObjectMeta: v1types.ObjectMeta{
-			Name: id,
-			Labels: map[string]string{
-				"heritage": "deis",
-			},
-		},
-	}
-	if _, err := clientset.Core().Namespaces().Create(namespace); err != nil {
+	if err := scheduler.CreateApp(app); err != nil {
 		return nil, err
 	}
 	return app, nil
@@ -70,16 +107,20 @@ func (a *App) String() string {
 	return a.ID
 }
 
-// LatestRelease returns the most recent release in the ledger.
+// LatestRelease returns the most recent release in the ledger. It does not reorder the ledger,
+// so it is safe to call while others are reading it.
 func (a *App) LatestRelease() *Release {
-	if len(a.Ledger) == 0 {
-		return nil
+	var latest *Release
+	for _, r := range a.Ledger {
+		if latest == nil || r.Version > latest.Version {
+			latest = r
+		}
 	}
-	sort.Sort(sort.Reverse(a.Ledger))
-	return a.Ledger[0]
+	return latest
 }
 
-// NewRelease appends a new release to the ledger using the provided build and config.
+// NewRelease appends a new release to the ledger using the provided build and config. The release
+// keeps the limits of the latest release; set its Limits before saving it to change them.
 func (a *App) NewRelease(build *Build, config *Config) *Release {
 	latestRelease := a.LatestRelease()
 	if latestRelease == nil {
@@ -99,23 +140,112 @@ func (a *App) NewRelease(build *Build, config *Config) *Release {
 		Build:   build,
 		Config:  config,
 		Version: latestRelease.Version + 1,
+		Created: time.Now(),
+		Limits:  latestRelease.Limits,
 	}
 	a.Ledger = append(a.Ledger, release)
 	return release
 }
 
-// Rollback appends a new release to the ledger using the specified release's build + config.
-func (a *App) Rollback(version int) error {
-	if version < 1 {
-		return errors.New("version cannot be below 0")
-	}
+// Release returns the release with the given version from the ledger, or nil if there is none.
+func (a *App) Release(version int) *Release {
 	for _, r := range a.Ledger {
 		if r.Version == version {
-			release := a.NewRelease(r.Build, r.Config)
-			return release.Publish()
+			return r
+		}
+	}
+	return nil
+}
+
+// Rollback appends a new release to the ledger using the specified release's build, config and
+// limits exactly as they were, then publishes it to the scheduler. A release without a build, such
+// as the app's first release, cannot be rolled back to. The new release is returned even if
+// publishing it fails, since it has already been appended to the ledger.
+func (a *App) Rollback(version int, scheduler Scheduler) (*Release, error) {
+	if version < 1 {
+		return nil, ErrInvalidVersion
+	}
+	r := a.Release(version)
+	if r == nil {
+		return nil, ErrReleaseNotFound
+	}
+	if r.Build == nil {
+		return nil, &ReleaseError{fmt.Sprintf("v%d has no build to roll back to", version)}
+	}
+	release := a.NewRelease(r.Build, r.Config)
+	// NewRelease would keep the latest config if the release had none
+	release.Config = r.Config
+	release.Limits = r.Limits
+	return release, release.Publish(scheduler)
+}
+
+// Scale sets the number of processes for the given process types and applies it through the
+// scheduler. Process types which are not mentioned keep their current scale.
+func (a *App) Scale(structure map[string]int, scheduler Scheduler) error {
+	release := a.LatestRelease()
+	if release == nil || release.Build == nil {
+		return &ScaleError{"no build has been deployed yet"}
+	}
+	for typ, n := range structure {
+		if _, ok := release.Build.Procfile[typ]; !ok {
+			return &ScaleError{fmt.Sprintf("process type %s is not in the Procfile", typ)}
+		}
+		if n < 0 {
+			return &ScaleError{fmt.Sprintf("cannot scale %s below 0", typ)}
+		}
+	}
+	if err := scheduler.Scale(a, structure); err != nil {
+		return err
+	}
+	if a.Structure == nil {
+		a.Structure = make(map[string]int)
+	}
+	for typ, n := range structure {
+		a.Structure[typ] = n
+	}
+	a.Updated = time.Now()
+	return nil
+}
+
+// CanAccess reports whether the user is allowed to see and change the app: admins can access
+// every app, everybody else only the apps they own or collaborate on.
+func (a *App) CanAccess(user *User) bool {
+	if user.Admin || user.Username == a.Owner {
+		return true
+	}
+	for _, c := range a.Collaborators {
+		if c == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// AddCollaborator shares the app with the given user.
+func (a *App) AddCollaborator(username string) error {
+	if username == a.Owner {
+		return ErrCollaboratorExists
+	}
+	for _, c := range a.Collaborators {
+		if c == username {
+			return ErrCollaboratorExists
+		}
+	}
+	a.Collaborators = append(a.Collaborators, username)
+	a.Updated = time.Now()
+	return nil
+}
+
+// RemoveCollaborator stops sharing the app with the given user.
+func (a *App) RemoveCollaborator(username string) error {
+	for i, c := range a.Collaborators {
+		if c == username {
+			a.Collaborators = append(a.Collaborators[:i:i], a.Collaborators[i+1:]...)
+			a.Updated = time.Now()
+			return nil
 		}
 	}
-	return errors.New("release not found")
+	return ErrCollaboratorNotFound
 }
 
 func generateAppName() string {
@@ -1,12 +1,16 @@
-package api
+package api_test
 
 import (
 	"testing"
 	"time"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
 )
 
 func TestCreateApp(t *testing.T) {
-	app, _ := NewApp("test")
+	app, _ := api.NewApp("test", fake.New())
 
 	// close enough for government work!
 	if time.Since(app.Created) > time.Duration(10*time.Millisecond) {
@@ -30,16 +34,30 @@ func TestCreateApp(t *testing.T) {
 }
 
 func TestCreateAppWithNoID(t *testing.T) {
-	app, _ := NewApp("")
+	app, _ := api.NewApp("", fake.New())
 
 	if app.ID == "" {
 		t.Error("expected app ID to be generated, got empty string")
 	}
 }
 
+func TestCreateAppWithInvalidID(t *testing.T) {
+	scheduler := fake.New()
+	for _, id := range []string{"Autotest", "auto_test", "-autotest", "autotest-", "default", "kube-system", "kube-public"} {
+		if _, err := api.NewApp(id, scheduler); err == nil {
+			t.Errorf("expected app ID %q to be rejected", id)
+		} else if _, ok := err.(*api.AppError); !ok {
+			t.Errorf("%q: expected an AppError, got %v", id, err)
+		}
+	}
+	if calls := scheduler.Calls(); len(calls) != 0 {
+		t.Errorf("expected nothing to be created on the scheduler, got %+v", calls)
+	}
+}
+
 func TestAppRelease(t *testing.T) {
-	app, _ := NewApp("")
-	release := app.NewRelease(&Build{}, &Config{})
+	app, _ := api.NewApp("", fake.New())
+	release := app.NewRelease(&api.Build{}, &api.Config{})
 	if release == nil {
 		t.Errorf("expected app to create a new release")
 	}
@@ -50,7 +68,7 @@ func TestAppRelease(t *testing.T) {
 	if app.Ledger.Len() != 2 {
 		t.Errorf("expected release to be appended to the ledger; got %d", app.Ledger.Len())
 	}
-	app.NewRelease(&Build{}, &Config{})
+	app.NewRelease(&api.Build{}, &api.Config{})
 	if app.Ledger.Len() != 3 {
 		t.Errorf("expected ledger to have 3 releases; got %d", app.Ledger.Len())
 	}
@@ -58,28 +76,50 @@ func TestAppRelease(t *testing.T) {
 		t.Errorf("expected v2 to be less than v3. v1 = %d; v2 = %d", app.Ledger[1].Version, app.Ledger[2].Version)
 	}
 	app.Ledger.Swap(1, 2)
-	if app.Ledger[0] != release {
-		t.Errorf("expected v2 to be first; got %s", app.Ledger[0])
+	if app.Ledger[2] != release {
+		t.Errorf("expected v2 to be last; got %s", app.Ledger[2])
+	}
+}
+
+func TestLatestReleaseDoesNotReorderLedger(t *testing.T) {
+	app, _ := api.NewApp("", fake.New())
+	app.NewRelease(&api.Build{}, &api.Config{})
+	app.NewRelease(&api.Build{}, &api.Config{})
+	if latest := app.LatestRelease(); latest.Version != 3 {
+		t.Errorf("expected v3 to be the latest release; got v%d", latest.Version)
+	}
+	for i, r := range app.Ledger {
+		if r.Version != i+1 {
+			t.Errorf("expected the ledger to stay in order; got v%d at %d", r.Version, i)
+		}
 	}
 }
 
 func TestAppRollback(t *testing.T) {
-	app, _ := NewApp("")
-	release2 := app.NewRelease(&Build{}, &Config{})
-	app.NewRelease(&Build{}, &Config{})
+	app, _ := api.NewApp("", fake.New())
+	release2 := app.NewRelease(&api.Build{}, &api.Config{})
+	release2.Limits = api.Limits{"web": {MemoryLimit: "512Mi"}}
+	release3 := app.NewRelease(&api.Build{}, &api.Config{})
+	release3.Limits = api.Limits{"web": {MemoryLimit: "1Gi"}}
 
 	// first, check that we cannot roll back to an invalid version
-	if err := app.Rollback(0); err == nil {
+	if _, err := app.Rollback(0, fake.New()); err != api.ErrInvalidVersion {
 		t.Errorf("expected rolling back to an invalid version number to error")
 	}
 
 	// now check that we cannot roll forward to a release that does not exist yet
-	if err := app.Rollback(100); err == nil {
+	if _, err := app.Rollback(100, fake.New()); err != api.ErrReleaseNotFound {
 		t.Errorf("expected rolling forward to an invalid version number to error")
 	}
 
 	// NOW we roll back.
-	app.Rollback(2)
+	release4, err := app.Rollback(2, fake.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release4.Version != 4 {
+		t.Errorf("expected rollback to return v4, got v%d", release4.Version)
+	}
 	if app.Ledger.Len() != 4 {
 		t.Errorf("expected ledger to have 4 releases; got %d", app.Ledger.Len())
 	}
@@ -89,4 +129,126 @@ func TestAppRollback(t *testing.T) {
 	if app.Ledger[len(app.Ledger)-1].Version != 4 {
 		t.Errorf("expected new release to be v4, got v%d", app.Ledger[2].Version)
 	}
+	if limit := release4.Limits["web"].MemoryLimit; limit != "512Mi" {
+		t.Errorf("expected the rollback to restore v2's limits, got %q", limit)
+	}
+
+	// v1 has no build, so there is nothing to roll back to
+	if _, err := app.Rollback(1, fake.New()); err == nil {
+		t.Error("expected rolling back to a release without a build to error")
+	} else if _, ok := err.(*api.ReleaseError); !ok {
+		t.Errorf("expected a ReleaseError, got %T", err)
+	}
+	if app.Ledger.Len() != 4 {
+		t.Errorf("expected no release to be created, got %d releases", app.Ledger.Len())
+	}
+}
+
+func TestAppRollbackAcrossConfigChange(t *testing.T) {
+	app, _ := api.NewApp("", fake.New())
+	build := &api.Build{Image: "deis/example-go:latest"}
+	app.NewRelease(build, nil)
+	app.NewRelease(nil, &api.Config{Values: []v1types.EnvVar{{Name: "FOO", Value: "bar"}}})
+
+	// v2 was released before any config was set, so rolling back to it drops FOO
+	release, err := app.Rollback(2, fake.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Build != build {
+		t.Errorf("expected v2's build, got %v", release.Build)
+	}
+	if _, ok := release.Config.Get("FOO"); ok {
+		t.Errorf("expected the config of v2, which has no FOO, got %+v", release.Config)
+	}
+}
+
+func TestCreateAppCreatesItOnTheScheduler(t *testing.T) {
+	scheduler := fake.New()
+	if _, err := api.NewApp("test", scheduler); err != nil {
+		t.Fatal(err)
+	}
+	if !scheduler.Apps["test"] {
+		t.Errorf("expected app to be created on the scheduler; calls were %v", scheduler.Calls())
+	}
+}
+
+func TestReleasePublish(t *testing.T) {
+	scheduler := fake.New()
+	app, _ := api.NewApp("test", scheduler)
+	if err := app.LatestRelease().Publish(scheduler); err != api.ErrNoBuildToPublish {
+		t.Errorf("expected publishing a release without a build to fail with ErrNoBuildToPublish, got %v", err)
+	}
+	release := app.NewRelease(&api.Build{Image: "deis/example-go:latest"}, nil)
+	if err := release.Publish(scheduler); err != nil {
+		t.Fatal(err)
+	}
+	if scheduler.Releases["test"] != release {
+		t.Errorf("expected v%d to be deployed to the scheduler", release.Version)
+	}
+}
+
+func TestAppScale(t *testing.T) {
+	scheduler := fake.New()
+	app, _ := api.NewApp("test", scheduler)
+	if err := app.Scale(map[string]int{"web": 2}, scheduler); err == nil {
+		t.Errorf("expected scaling an app without a build to fail")
+	}
+	procfile := map[string][]string{"web": []string{"/bin/boot"}}
+	app.NewRelease(&api.Build{Procfile: procfile}, nil)
+	if err := app.Scale(map[string]int{"web": -1}, scheduler); err == nil {
+		t.Errorf("expected scaling below 0 to fail")
+	}
+	if err := app.Scale(map[string]int{"web": 2}, scheduler); err != nil {
+		t.Fatal(err)
+	}
+	if app.Structure["web"] != 2 {
+		t.Errorf("expected web to be scaled to 2, got %d", app.Structure["web"])
+	}
+
+	// every new release is scaled to the app's structure
+	release := app.NewRelease(&api.Build{Procfile: procfile}, nil)
+	if err := release.Publish(scheduler); err != nil {
+		t.Fatal(err)
+	}
+	calls := scheduler.CallsTo("Scale")
+	if len(calls) != 2 || calls[1].Structure["web"] != 2 {
+		t.Errorf("expected the new release to be scaled to web=2, got %v", calls)
+	}
+}
+
+func TestAppCollaborators(t *testing.T) {
+	app, _ := api.NewApp("test", fake.New())
+	app.Owner = "owner"
+	owner := &api.User{Username: "owner"}
+	friend := &api.User{Username: "friend"}
+	admin := &api.User{Username: "admin", Admin: true}
+
+	if !app.CanAccess(owner) || !app.CanAccess(admin) {
+		t.Error("expected the owner and admins to access the app")
+	}
+	if app.CanAccess(friend) {
+		t.Error("expected other users not to access the app")
+	}
+	if err := app.AddCollaborator("friend"); err != nil {
+		t.Fatal(err)
+	}
+	if !app.CanAccess(friend) {
+		t.Error("expected collaborators to access the app")
+	}
+	if err := app.AddCollaborator("friend"); err != api.ErrCollaboratorExists {
+		t.Errorf("expected ErrCollaboratorExists when adding a collaborator twice, got %v", err)
+	}
+	if err := app.AddCollaborator("owner"); err != api.ErrCollaboratorExists {
+		t.Errorf("expected ErrCollaboratorExists when adding the owner, got %v", err)
+	}
+	if err := app.RemoveCollaborator("friend"); err != nil {
+		t.Fatal(err)
+	}
+	if app.CanAccess(friend) {
+		t.Error("expected removed collaborators to lose access")
+	}
+	if err := app.RemoveCollaborator("friend"); err != api.ErrCollaboratorNotFound {
+		t.Errorf("expected ErrCollaboratorNotFound, got %v", err)
+	}
 }
@@ -1,5 +1,24 @@
 package api
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// a process type becomes part of the names of the scheduler's resources, with underscores turned
+// into hyphens, so it must be a DNS label once they are
+var processTypeRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]{0,61}[a-z0-9])?$`)
+
+// BuildError is returned when a build cannot be deployed as it is.
+type BuildError struct {
+	Message string
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("invalid build: %s", e.Message)
+}
+
 // Build is an executable bundle of software built from source at a specific version or commit
 // specified by the deployment process.
 //
@@ -19,3 +38,24 @@ type Build struct {
 func (b *Build) String() string {
 	return b.Image
 }
+
+// Validate checks that the build has an image, and that every process type of its Procfile can
+// name the scheduler's resources. Process types which only differ by hyphens and underscores,
+// such as web_1 and web-1, would share those names, so they cannot be used together.
+func (b *Build) Validate() error {
+	if b.Image == "" {
+		return &BuildError{"an image is required"}
+	}
+	seen := make(map[string]string, len(b.Procfile))
+	for typ := range b.Procfile {
+		if !processTypeRegexp.MatchString(typ) {
+			return &BuildError{fmt.Sprintf("process type %q must consist of at most 63 lower case letters, digits, hyphens and underscores, and must start and end with a letter or digit", typ)}
+		}
+		name := strings.Replace(typ, "_", "-", -1)
+		if other, ok := seen[name]; ok {
+			return &BuildError{fmt.Sprintf("process types %s and %s cannot be used together", other, typ)}
+		}
+		seen[name] = typ
+	}
+	return nil
+}
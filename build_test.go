@@ -0,0 +1,34 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/fishworks/api"
+)
+
+func TestBuildValidate(t *testing.T) {
+	tests := []struct {
+		procfile map[string][]string
+		valid    bool
+	}{
+		{nil, true},
+		{map[string][]string{"web": {"./web"}, "background_worker": {"./worker"}, "clock-2": {"./clock"}}, true},
+		{map[string][]string{"Web": {"./web"}}, false},
+		{map[string][]string{"web.1": {"./web"}}, false},
+		{map[string][]string{"_web": {"./web"}}, false},
+		// both would name their deployment <app>-web-1
+		{map[string][]string{"web_1": {"./web"}, "web-1": {"./web"}}, false},
+	}
+	for _, tt := range tests {
+		err := (&api.Build{Image: "deis/example-go:latest", Procfile: tt.procfile}).Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%v: expected valid=%t, got %v", tt.procfile, tt.valid, err)
+		}
+		if _, ok := err.(*api.BuildError); err != nil && !ok {
+			t.Errorf("%v: expected a BuildError, got %T", tt.procfile, err)
+		}
+	}
+	if err := (&api.Build{}).Validate(); err == nil {
+		t.Error("expected a build without an image to be invalid")
+	}
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrCertNotFound is returned when removing a certificate which the app does not have.
+var ErrCertNotFound = errors.New("certificate is not attached to this app")
+
+// part of a Kubernetes secret name, which is a lower case DNS subdomain of at most 253
+// characters. The scheduler adds 13 characters to it: a "tls-" prefix and a fingerprint suffix.
+var certNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,238}[a-z0-9])?$`)
+
+// CertError is returned when a certificate or its key cannot be used.
+type CertError struct {
+	Message string
+}
+
+func (e *CertError) Error() string {
+	return fmt.Sprintf("invalid certificate: %s", e.Message)
+}
+
+// Cert is a TLS certificate which serves some of an app's domains over HTTPS.
+type Cert struct {
+	// Name identifies the certificate within its app. It defaults to the certificate's common
+	// name, with dots replaced by dashes.
+	Name       string `json:"name"`
+	CommonName string `json:"common_name"`
+	// Domains are the DNS names the certificate is valid for.
+	Domains     []string  `json:"domains"`
+	Issuer      string    `json:"issuer"`
+	Fingerprint string    `json:"fingerprint"`
+	Starts      time.Time `json:"starts"`
+	Expires     time.Time `json:"expires"`
+	Created     time.Time `json:"created"`
+	// Certificate and Key are the PEM encoded certificate chain and private key. Only the
+	// scheduler needs them: they are neither returned by the API nor written to disk by the store.
+	Certificate string `json:"-"`
+	Key         string `json:"-"`
+}
+
+// NewCert parses a PEM encoded certificate chain and its private key. It fails if the key does
+// not belong to the certificate, or if the certificate is not currently valid. If name is empty,
+// it is derived from the certificate's common name.
+func NewCert(name, certPEM, keyPEM string) (*Cert, error) {
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, &CertError{err.Error()}
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, &CertError{err.Error()}
+	}
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		return nil, &CertError{fmt.Sprintf("expired on %s", leaf.NotAfter.Format(time.RFC3339))}
+	}
+	if now.Before(leaf.NotBefore) {
+		return nil, &CertError{fmt.Sprintf("not valid before %s", leaf.NotBefore.Format(time.RFC3339))}
+	}
+	domains := leaf.DNSNames
+	if len(domains) == 0 && leaf.Subject.CommonName != "" {
+		// certificates without SANs are only valid for their common name
+		domains = []string{leaf.Subject.CommonName}
+	}
+	if len(domains) == 0 {
+		return nil, &CertError{"not valid for any domain"}
+	}
+	for i, d := range domains {
+		domains[i] = strings.ToLower(d)
+	}
+	if name == "" {
+		base := leaf.Subject.CommonName
+		if base == "" {
+			base = domains[0]
+		}
+		name = strings.Replace(strings.Replace(strings.ToLower(base), "*", "wildcard", 1), ".", "-", -1)
+	}
+	if !certNameRegexp.MatchString(name) {
+		return nil, &CertError{fmt.Sprintf("%q is not a valid name; use at most 240 lower case letters, digits, dashes and dots", name)}
+	}
+	return &Cert{
+		Name:        name,
+		CommonName:  leaf.Subject.CommonName,
+		Domains:     domains,
+		Issuer:      leaf.Issuer.CommonName,
+		Fingerprint: fmt.Sprintf("%X", sha256.Sum256(leaf.Raw)),
+		Starts:      leaf.NotBefore,
+		Expires:     leaf.NotAfter,
+		Created:     now,
+		Certificate: certPEM,
+		Key:         keyPEM,
+	}, nil
+}
+
+// Covers reports whether the certificate is valid for the domain. A wildcard certificate covers
+// every domain one level below it, as well as the matching wildcard domain.
+func (c *Cert) Covers(domain string) bool {
+	for _, d := range c.Domains {
+		if d == domain {
+			return true
+		}
+		if strings.HasPrefix(d, "*.") {
+			if i := strings.Index(domain, "."); i > 0 && domain[i:] == d[1:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CertDomains returns the domains of the app which the certificate covers.
+func (a *App) CertDomains(cert *Cert) []string {
+	var domains []string
+	for _, d := range a.Domains {
+		if cert.Covers(d) {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// SetCert attaches a certificate to the app, replacing any certificate with the same name.
+func (a *App) SetCert(cert *Cert) {
+	for i, c := range a.Certs {
+		if c.Name == cert.Name {
+			certs := append([]*Cert(nil), a.Certs...)
+			certs[i] = cert
+			a.Certs = certs
+			a.Updated = time.Now()
+			return
+		}
+	}
+	a.Certs = append(a.Certs, cert)
+	a.Updated = time.Now()
+}
+
+// RemoveCert detaches the named certificate from the app and returns it.
+func (a *App) RemoveCert(name string) (*Cert, error) {
+	for i, c := range a.Certs {
+		if c.Name == name {
+			a.Certs = append(a.Certs[:i:i], a.Certs[i+1:]...)
+			a.Updated = time.Now()
+			return c, nil
+		}
+	}
+	return nil, ErrCertNotFound
+}
@@ -0,0 +1,132 @@
+package api_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+// selfSignedCert returns a PEM encoded certificate valid from notBefore to notAfter, and its key.
+func selfSignedCert(t *testing.T, commonName string, dnsNames []string, notBefore, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestNewCert(t *testing.T) {
+	now := time.Now()
+	certPEM, keyPEM := selfSignedCert(t, "*.example.com", []string{"*.example.com", "example.com"}, now.Add(-time.Hour), now.Add(time.Hour))
+	cert, err := api.NewCert("", certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Name != "wildcard-example-com" {
+		t.Errorf("expected the name to be derived from the common name, got %s", cert.Name)
+	}
+	if cert.CommonName != "*.example.com" || len(cert.Domains) != 2 {
+		t.Errorf("expected the common name and SANs to be parsed, got %s and %v", cert.CommonName, cert.Domains)
+	}
+	if cert.Fingerprint == "" || cert.Expires.IsZero() {
+		t.Error("expected the fingerprint and expiry to be set")
+	}
+	for domain, covered := range map[string]bool{
+		"example.com":       true,
+		"www.example.com":   true,
+		"*.example.com":     true,
+		"a.b.example.com":   false,
+		"www.example.org":   false,
+		"wwwexample.com":    false,
+		"www.sub.other.com": false,
+	} {
+		if cert.Covers(domain) != covered {
+			t.Errorf("expected Covers(%s) to be %t", domain, covered)
+		}
+	}
+}
+
+func TestNewCertRejectsUnusableCerts(t *testing.T) {
+	now := time.Now()
+	expired, expiredKey := selfSignedCert(t, "example.com", nil, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	if _, err := api.NewCert("", expired, expiredKey); err == nil {
+		t.Error("expected an expired certificate to be rejected")
+	}
+	future, futureKey := selfSignedCert(t, "example.com", nil, now.Add(time.Hour), now.Add(2*time.Hour))
+	if _, err := api.NewCert("", future, futureKey); err == nil {
+		t.Error("expected a certificate which is not valid yet to be rejected")
+	}
+	certPEM, _ := selfSignedCert(t, "example.com", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	_, otherKey := selfSignedCert(t, "example.com", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	if _, err := api.NewCert("", certPEM, otherKey); err == nil {
+		t.Error("expected a key which does not match the certificate to be rejected")
+	}
+	if _, err := api.NewCert("", "not a certificate", "not a key"); err == nil {
+		t.Error("expected garbage to be rejected")
+	}
+	certPEM, keyPEM := selfSignedCert(t, "example.com", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	if _, err := api.NewCert(strings.Repeat("a", 240), certPEM, keyPEM); err != nil {
+		t.Errorf("expected a name of 240 characters to be accepted, got %v", err)
+	}
+	if _, err := api.NewCert(strings.Repeat("a", 241), certPEM, keyPEM); err == nil {
+		t.Error("expected a name too long for a secret to be rejected")
+	}
+}
+
+func TestAppCerts(t *testing.T) {
+	app, _ := api.NewApp("test", fake.New())
+	app.AddDomain("www.example.com")
+	app.AddDomain("www.example.org")
+
+	now := time.Now()
+	certPEM, keyPEM := selfSignedCert(t, "www.example.com", []string{"www.example.com"}, now.Add(-time.Hour), now.Add(time.Hour))
+	cert, err := api.NewCert("", certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domains := app.CertDomains(cert); len(domains) != 1 || domains[0] != "www.example.com" {
+		t.Errorf("expected the certificate to cover www.example.com only, got %v", domains)
+	}
+	app.SetCert(cert)
+	renewed, err := api.NewCert("", certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetCert(renewed)
+	if len(app.Certs) != 1 || app.Certs[0] != renewed {
+		t.Errorf("expected a certificate with the same name to be replaced, got %v", app.Certs)
+	}
+	if _, err := app.RemoveCert(cert.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.RemoveCert(cert.Name); err != api.ErrCertNotFound {
+		t.Errorf("expected ErrCertNotFound, got %v", err)
+	}
+}
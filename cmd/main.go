@@ -2,31 +2,32 @@ package main
 
 import (
 	"flag"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api/scheduler/k8s"
 	"github.com/fishworks/api/server"
 	"github.com/fishworks/api/settings"
-
-	"k8s.io/client-go/1.4/kubernetes"
-	"k8s.io/client-go/1.4/rest"
+	"github.com/fishworks/api/store"
 )
 
-func validateSettings() {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		log.Fatal(err)
-	}
-	if _, err := kubernetes.NewForConfig(config); err != nil {
-		log.Fatal(err)
-	}
-}
-
 func main() {
 	flag.StringVar(&settings.ListenAddress, "a", "tcp://0.0.0.0:8080", "")
 	flag.StringVar(&settings.ListenAddress, "addr", "tcp://0.0.0.0:8080", "")
 	flag.StringVar(&settings.LogLevel, "l", "info", "")
 	flag.StringVar(&settings.LogLevel, "log-level", "info", "")
+	flag.StringVar(&settings.StoreURL, "s", "memory://", "")
+	flag.StringVar(&settings.StoreURL, "store", "memory://", "")
+	flag.StringVar(&settings.AdminUsername, "admin-user", "admin", "")
+	flag.StringVar(&settings.AdminPassword, "admin-password", os.Getenv("API_ADMIN_PASSWORD"), "")
+	flag.StringVar(&settings.TLSCert, "tls-cert", "", "")
+	flag.StringVar(&settings.TLSKey, "tls-key", "", "")
+	flag.StringVar(&settings.TLSClientCA, "tls-client-ca", "", "")
+	flag.DurationVar(&settings.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "")
 	flag.Parse()
 
 	if level, err := log.ParseLevel(settings.LogLevel); err != nil {
@@ -34,15 +35,70 @@ func main() {
 	} else {
 		log.SetLevel(level)
 	}
-	validateSettings()
+	scheduler, err := k8s.New()
+	if err != nil {
+		log.Fatalf("failed to connect to the cluster: %v", err)
+	}
+	server.Scheduler = server.InstrumentScheduler(scheduler)
+
+	driverAndPath := strings.SplitN(settings.StoreURL, "://", 2)
+	if len(driverAndPath) != 2 {
+		log.Fatalf("invalid store %s: expected driver://path", settings.StoreURL)
+	}
+	db, err := store.New(driverAndPath[0], driverAndPath[1])
+	if err != nil {
+		log.Fatalf("failed to open store at %s: %v", settings.StoreURL, err)
+	}
+	defer db.Close()
+	// log.Fatalf exits without running deferred calls, so the store is closed by hand first
+	fatalf := func(format string, args ...interface{}) {
+		db.Close()
+		log.Fatalf(format, args...)
+	}
+	server.Store = db
+	if err := server.BootstrapAdmin(settings.AdminUsername, settings.AdminPassword); err != nil {
+		fatalf("failed to create admin user %s: %v", settings.AdminUsername, err)
+	}
+
+	server.TLSCertFile = settings.TLSCert
+	server.TLSKeyFile = settings.TLSKey
+	server.TLSClientCAFile = settings.TLSClientCA
 
 	protoAndAddr := strings.SplitN(settings.ListenAddress, "://", 2)
 	server, err := server.New(protoAndAddr[0], protoAndAddr[1])
 	if err != nil {
-		log.Fatalf("failed to create server at %s: %v", settings.ListenAddress, err)
+		fatalf("failed to create server at %s: %v", settings.ListenAddress, err)
 	}
+
+	// reload the TLS certificate on SIGHUP, e.g. after it was renewed
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := server.ReloadCertificate(); err != nil {
+				log.Errorf("failed to reload TLS certificate: %v", err)
+			} else {
+				log.Info("reloaded TLS certificate")
+			}
+		}
+	}()
+
+	// on SIGTERM or SIGINT, e.g. during a rolling upgrade, let the requests in flight finish and
+	// flush the store before exiting
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve()
+	}()
 	log.Printf("server is now listening at %s", settings.ListenAddress)
-	if err = server.Serve(); err != nil {
-		log.Fatal(err)
+	select {
+	case err := <-errc:
+		fatalf("%v", err)
+	case sig := <-stop:
+		log.Infof("received %s, shutting down", sig)
+		if err := server.Shutdown(settings.ShutdownTimeout); err != nil {
+			log.Warnf("shutting down: %v", err)
+		}
 	}
 }
@@ -6,7 +6,70 @@ import (
 
 // Config is a map of key/value strings which specify the environment variables that should exist
 // in the execution environment.
+//
+// Like releases, configs are never modified once they are created. Merge and Unset return a new
+// config instead.
 type Config struct {
 	App    *App             `json:"-"`
 	Values []v1types.EnvVar `json:"values"`
 }
+
+// Get returns the value of the named variable and whether it is set.
+func (c *Config) Get(name string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	for _, v := range c.Values {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+// Merge returns a new config with the given values set, replacing any existing variables with the
+// same name. Variables keep the position they had in c; new variables are appended in order.
+// Merge may be called on a nil config.
+func (c *Config) Merge(values []v1types.EnvVar) *Config {
+	merged := &Config{}
+	if c != nil {
+		merged.App = c.App
+		merged.Values = append(merged.Values, c.Values...)
+	}
+	for _, v := range values {
+		replaced := false
+		for i := range merged.Values {
+			if merged.Values[i].Name == v.Name {
+				merged.Values[i] = v
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged.Values = append(merged.Values, v)
+		}
+	}
+	return merged
+}
+
+// Unset returns a new config without the named variables. Unset may be called on a nil config.
+func (c *Config) Unset(names ...string) *Config {
+	unset := &Config{}
+	if c == nil {
+		return unset
+	}
+	unset.App = c.App
+	for _, v := range c.Values {
+		keep := true
+		for _, name := range names {
+			if v.Name == name {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			unset.Values = append(unset.Values, v)
+		}
+	}
+	return unset
+}
@@ -0,0 +1,52 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/fishworks/api"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func TestConfigMergeByName(t *testing.T) {
+	config := &api.Config{Values: []v1types.EnvVar{{Name: "FOO", Value: "foo"}, {Name: "BAR", Value: "bar"}}}
+	merged := config.Merge([]v1types.EnvVar{{Name: "BAR", Value: "baz"}, {Name: "QUX", Value: "qux"}})
+
+	expected := []v1types.EnvVar{{Name: "FOO", Value: "foo"}, {Name: "BAR", Value: "baz"}, {Name: "QUX", Value: "qux"}}
+	if len(merged.Values) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, merged.Values)
+	}
+	for i := range expected {
+		if merged.Values[i] != expected[i] {
+			t.Errorf("expected %v at %d, got %v", expected[i], i, merged.Values[i])
+		}
+	}
+	// the original config must not be modified
+	if v, _ := config.Get("BAR"); v != "bar" {
+		t.Errorf("expected the original config to keep BAR=bar, got %s", v)
+	}
+}
+
+func TestConfigMergeIntoNil(t *testing.T) {
+	var config *api.Config
+	merged := config.Merge([]v1types.EnvVar{{Name: "FOO", Value: "1"}, {Name: "FOO", Value: "2"}})
+	if len(merged.Values) != 1 {
+		t.Fatalf("expected duplicate names to collapse, got %v", merged.Values)
+	}
+	if v, _ := merged.Get("FOO"); v != "2" {
+		t.Errorf("expected the last value to win, got %s", v)
+	}
+}
+
+func TestConfigUnset(t *testing.T) {
+	config := &api.Config{Values: []v1types.EnvVar{{Name: "FOO", Value: "foo"}, {Name: "BAR", Value: "bar"}}}
+	unset := config.Unset("FOO")
+	if _, ok := unset.Get("FOO"); ok {
+		t.Error("expected FOO to be unset")
+	}
+	if _, ok := unset.Get("BAR"); !ok {
+		t.Error("expected BAR to be kept")
+	}
+	if _, ok := config.Get("FOO"); !ok {
+		t.Error("expected the original config to keep FOO")
+	}
+}
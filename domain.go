@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrDomainExists is returned when adding a domain which the app already has.
+	ErrDomainExists = errors.New("domain is already attached to this app")
+	// ErrDomainNotFound is returned when removing a domain which the app does not have.
+	ErrDomainNotFound = errors.New("domain is not attached to this app")
+)
+
+// a DNS label as per RFC 1123: letters, digits and hyphens, not starting or ending with a hyphen
+var labelRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// DomainError is returned when a domain is not a valid hostname.
+type DomainError struct {
+	Domain  string
+	Message string
+}
+
+func (e *DomainError) Error() string {
+	return fmt.Sprintf("invalid domain %s: %s", e.Domain, e.Message)
+}
+
+// ValidateDomain checks that domain is a fully qualified hostname, such as www.example.com. The
+// leftmost label may be a wildcard, as in *.example.com. Domains are compared in lower case, so
+// domain must be lower case.
+func ValidateDomain(domain string) error {
+	if len(domain) > 253 {
+		return &DomainError{domain, "must be at most 253 characters long"}
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return &DomainError{domain, "must be fully qualified, such as www.example.com"}
+	}
+	for i, label := range labels {
+		if i == 0 && label == "*" {
+			continue
+		}
+		if !labelRegexp.MatchString(label) {
+			return &DomainError{domain, fmt.Sprintf("%q is not a valid DNS label", label)}
+		}
+	}
+	return nil
+}
+
+// AddDomain attaches a domain to the app. The domain is validated, but it is up to the caller to
+// make sure no other app uses it.
+func (a *App) AddDomain(domain string) error {
+	if err := ValidateDomain(domain); err != nil {
+		return err
+	}
+	if a.HasDomain(domain) {
+		return ErrDomainExists
+	}
+	a.Domains = append(a.Domains, domain)
+	a.Updated = time.Now()
+	return nil
+}
+
+// RemoveDomain detaches a domain from the app.
+func (a *App) RemoveDomain(domain string) error {
+	for i, d := range a.Domains {
+		if d == domain {
+			a.Domains = append(a.Domains[:i:i], a.Domains[i+1:]...)
+			a.Updated = time.Now()
+			return nil
+		}
+	}
+	return ErrDomainNotFound
+}
+
+// HasDomain reports whether the domain is attached to the app.
+func (a *App) HasDomain(domain string) bool {
+	for _, d := range a.Domains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package api_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+func TestValidateDomain(t *testing.T) {
+	valid := []string{
+		"example.com",
+		"www.example.com",
+		"*.example.com",
+		"my-app.example.co.uk",
+		"123.example.com",
+	}
+	for _, domain := range valid {
+		if err := api.ValidateDomain(domain); err != nil {
+			t.Errorf("expected %s to be valid, got %v", domain, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"localhost",
+		"example..com",
+		"-example.com",
+		"example-.com",
+		"www.*.example.com",
+		"exa_mple.com",
+		"Example.com",
+		"example.com.",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat("a.", 127) + "com",
+	}
+	for _, domain := range invalid {
+		if err := api.ValidateDomain(domain); err == nil {
+			t.Errorf("expected %q to be invalid", domain)
+		}
+	}
+}
+
+func TestAppDomains(t *testing.T) {
+	app, _ := api.NewApp("test", fake.New())
+	if err := app.AddDomain("not a domain"); err == nil {
+		t.Error("expected an invalid domain to be rejected")
+	}
+	if err := app.AddDomain("www.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if !app.HasDomain("www.example.com") {
+		t.Error("expected the domain to be attached to the app")
+	}
+	if err := app.AddDomain("www.example.com"); err != api.ErrDomainExists {
+		t.Errorf("expected ErrDomainExists when adding a domain twice, got %v", err)
+	}
+	if err := app.RemoveDomain("www.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RemoveDomain("www.example.com"); err != api.ErrDomainNotFound {
+		t.Errorf("expected ErrDomainNotFound, got %v", err)
+	}
+}
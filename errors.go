@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+)
+
+// The errors below describe why a request could not be carried out. Along with the other errors
+// of this package, such as ReleaseError, and those of the store, the server maps each of them to
+// an HTTP status code and to a stable error code which clients can rely on, unlike the message.
+
+// NotFoundError is returned when the requested resource does not exist.
+type NotFoundError struct {
+	// Kind is the kind of resource, such as "app" or "release". The error code is derived from
+	// it, as in app_not_found.
+	Kind string
+	ID   string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("could not find %s %s", e.Kind, e.ID)
+}
+
+// ConflictError is returned when a resource is already taken, such as a domain used by another
+// app.
+type ConflictError struct {
+	// Kind is the kind of resource, such as "domain". The error code is derived from it, as in
+	// domain_exists.
+	Kind    string
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// InvalidRequestError is returned when a request is malformed or misses a required value.
+type InvalidRequestError struct {
+	Message string
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.Message
+}
+
+// UnauthorizedError is returned when a request does not carry valid credentials.
+type UnauthorizedError struct {
+	Message string
+}
+
+func (e *UnauthorizedError) Error() string {
+	return fmt.Sprintf("could not authenticate: %s", e.Message)
+}
+
+// ForbiddenError is returned when the authenticated user may not do what the request asks.
+type ForbiddenError struct {
+	Message string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+// SchedulerError is returned when the scheduler fails to carry out a change.
+type SchedulerError struct {
+	Message string
+}
+
+func (e *SchedulerError) Error() string {
+	return e.Message
+}
+
+// TimeoutError is returned when a change was started on the scheduler, but did not complete in
+// time.
+type TimeoutError struct {
+	Message string
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/1.4/pkg/api/resource"
+)
+
+// Resources are the compute resources reserved for and available to each process of a process
+// type. Amounts use Kubernetes quantities, such as "250m" of CPU or "512Mi" of memory. Empty
+// amounts are left unset.
+type Resources struct {
+	// CPURequest is the CPU reserved for the process.
+	CPURequest string `json:"cpu_request,omitempty"`
+	// CPULimit is the most CPU the process may use.
+	CPULimit string `json:"cpu_limit,omitempty"`
+	// MemoryRequest is the memory reserved for the process.
+	MemoryRequest string `json:"memory_request,omitempty"`
+	// MemoryLimit is the most memory the process may use before it is killed.
+	MemoryLimit string `json:"memory_limit,omitempty"`
+}
+
+// OneOffType is the process type whose resources apply to one-off processes, which have no
+// process type of their own.
+const OneOffType = "run"
+
+// Limits holds the resources of each process type, keyed by process type. Process types which
+// are not listed get no requests or limits.
+//
+// Like configs, limits are never modified once they are in a release. Merge returns new limits
+// instead.
+type Limits map[string]Resources
+
+// LimitsError is returned when limits have an amount which is not a valid quantity, a negative
+// amount, or a request above its limit.
+type LimitsError struct {
+	Type    string
+	Message string
+}
+
+func (e *LimitsError) Error() string {
+	return fmt.Sprintf("invalid limits for %s: %s", e.Type, e.Message)
+}
+
+// Merge returns new limits with the resources of the given process types replaced. Process types
+// given empty resources are removed. Merge may be called on nil limits.
+func (l Limits) Merge(changes Limits) Limits {
+	merged := make(Limits, len(l))
+	for typ, res := range l {
+		merged[typ] = res
+	}
+	for typ, res := range changes {
+		if res == (Resources{}) {
+			delete(merged, typ)
+		} else {
+			merged[typ] = res
+		}
+	}
+	return merged
+}
+
+// Validate checks that every amount is a valid, non-negative quantity, and that no request is
+// above its limit.
+func (l Limits) Validate() error {
+	for typ, res := range l {
+		if err := validateAmounts(typ, "cpu", res.CPURequest, res.CPULimit); err != nil {
+			return err
+		}
+		if err := validateAmounts(typ, "memory", res.MemoryRequest, res.MemoryLimit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAmounts checks the request and limit of a single resource of a process type.
+func validateAmounts(typ, name, request, limit string) error {
+	var quantities []resource.Quantity
+	for _, amount := range []string{request, limit} {
+		if amount == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(amount)
+		if err != nil {
+			return &LimitsError{Type: typ, Message: fmt.Sprintf("%s amount %q is not a valid quantity", name, amount)}
+		}
+		if q.Sign() < 0 {
+			return &LimitsError{Type: typ, Message: fmt.Sprintf("%s amount %s is negative", name, amount)}
+		}
+		quantities = append(quantities, q)
+	}
+	if len(quantities) == 2 && quantities[0].Cmp(quantities[1]) > 0 {
+		return &LimitsError{Type: typ, Message: fmt.Sprintf("%s request %s is above its limit %s", name, request, limit)}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package api_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fishworks/api"
+)
+
+func TestLimitsMerge(t *testing.T) {
+	limits := api.Limits{
+		"web":    {CPULimit: "500m", MemoryLimit: "512Mi"},
+		"worker": {MemoryLimit: "256Mi"},
+	}
+	merged := limits.Merge(api.Limits{
+		"web":    {MemoryRequest: "256Mi", MemoryLimit: "1Gi"},
+		"worker": {},
+		"clock":  {CPULimit: "100m"},
+	})
+	expected := api.Limits{
+		"web":   {MemoryRequest: "256Mi", MemoryLimit: "1Gi"},
+		"clock": {CPULimit: "100m"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+	// the original limits must not be modified
+	if limits["worker"].MemoryLimit != "256Mi" || limits["web"].CPULimit != "500m" {
+		t.Errorf("expected the original limits to be kept, got %v", limits)
+	}
+}
+
+func TestLimitsMergeIntoNil(t *testing.T) {
+	var limits api.Limits
+	merged := limits.Merge(api.Limits{"web": {CPULimit: "1"}})
+	if merged["web"].CPULimit != "1" {
+		t.Errorf("expected the web limits to be set, got %v", merged)
+	}
+}
+
+func TestLimitsValidate(t *testing.T) {
+	tests := []struct {
+		resources api.Resources
+		valid     bool
+	}{
+		{api.Resources{CPURequest: "250m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "512Mi"}, true},
+		{api.Resources{MemoryLimit: "1Gi"}, true},
+		{api.Resources{CPURequest: "2"}, true},
+		{api.Resources{CPULimit: "lots"}, false},
+		{api.Resources{MemoryRequest: "512 MB"}, false},
+		{api.Resources{CPULimit: "-1"}, false},
+		{api.Resources{MemoryRequest: "-256Mi", MemoryLimit: "512Mi"}, false},
+		{api.Resources{CPURequest: "2", CPULimit: "500m"}, false},
+		{api.Resources{MemoryRequest: "1Gi", MemoryLimit: "512Mi"}, false},
+	}
+	for _, tt := range tests {
+		err := api.Limits{"web": tt.resources}.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid=%t, got %v", tt.resources, tt.valid, err)
+		}
+		if _, ok := err.(*api.LimitsError); err != nil && !ok {
+			t.Errorf("%+v: expected a LimitsError, got %T", tt.resources, err)
+		}
+	}
+}
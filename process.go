@@ -0,0 +1,35 @@
+package api
+
+import (
+	"time"
+)
+
+// The states a process can be in.
+const (
+	// ProcessStarting is the state of a process which is being scheduled, pulling its image or
+	// not ready to serve yet.
+	ProcessStarting = "starting"
+	// ProcessUp is the state of a process which is running and ready.
+	ProcessUp = "up"
+	// ProcessCrashed is the state of a process which exited with an error or cannot start, such
+	// as when its image cannot be pulled.
+	ProcessCrashed = "crashed"
+	// ProcessTerminating is the state of a process which is being stopped.
+	ProcessTerminating = "terminating"
+)
+
+// Process is a single running instance of one of an app's process types.
+type Process struct {
+	// Name identifies the process among all of the app's processes.
+	Name string `json:"name"`
+	// Type is the Procfile process type the process runs.
+	Type string `json:"type"`
+	// Version is the version of the release the process runs.
+	Version int `json:"version"`
+	// State is one of the Process* states.
+	State string `json:"state"`
+	// Restarts is the number of times the process was restarted after exiting.
+	Restarts int `json:"restarts"`
+	// Started is when the process was started, or the zero time if it has not started yet.
+	Started time.Time `json:"started"`
+}
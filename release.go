@@ -2,10 +2,7 @@ package api
 
 import (
 	"fmt"
-
-	"k8s.io/client-go/1.4/kubernetes"
-	v1types "k8s.io/client-go/1.4/pkg/api/v1"
-	"k8s.io/client-go/1.4/rest"
+	"time"
 )
 
 var (
@@ -26,56 +23,38 @@ func (r *ReleaseError) Error() string {
 // Releases are an append-only ledger and a release cannot be mutated once it is created.
 // Any change must create a new release.
 type Release struct {
-	App     *App    `json:"-"`
-	Build   *Build  `json:"-"`
-	Config  *Config `json:"-"`
-	Version int     `json:"version"`
+	App     *App      `json:"-"`
+	Build   *Build    `json:"build"`
+	Config  *Config   `json:"config"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Limits are the resources of the release's processes.
+	Limits Limits `json:"limits,omitempty"`
+	// Author is the name of the user who triggered the release.
+	Author string `json:"author"`
 }
 
 func (r *Release) String() string {
 	return fmt.Sprintf("%s_v%d", r.App.ID, r.Version)
 }
 
-// Publish publishes the release to kubernetes.
-func (r *Release) Publish() error {
+// Publish hands the release to the scheduler to be run, then scales it to the app's structure.
+func (r *Release) Publish(scheduler Scheduler) error {
 	if r.Build == nil {
 		return ErrNoBuildToPublish
 	}
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return err
-	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
+	if err := scheduler.Deploy(r); err != nil {
 		return err
 	}
-	for typ, command := range r.Build.Procfile {
-		podName := fmt.Sprintf("%s_%s", r.String(), typ)
-		pod := &v1types.Pod{
-			ObjectMeta: v1types.ObjectMeta{
-				Name:      podName,
-				Namespace: r.App.ID,
-				Labels: map[string]string{
-					"heritage": "deis",
-				},
-			},
-			Spec: v1types.PodSpec{
-				RestartPolicy: v1types.RestartPolicyAlways,
-				Containers: []v1types.Container{
-					v1types.Container{
-						Name:            podName,
-						Image:           r.Build.Image,
-						ImagePullPolicy: v1types.PullAlways,
-						Command:         command,
-						Env:             r.Config.Values,
-					},
-				},
-			},
-		}
-		// Schedule the pod
-		if _, err := clientset.Pods(r.App.ID).Create(pod); err != nil {
-			return err
+	// only scale the process types this release actually runs
+	structure := make(map[string]int)
+	for typ, n := range r.App.Structure {
+		if _, ok := r.Build.Procfile[typ]; ok {
+			structure[typ] = n
 		}
 	}
-	return nil
+	if len(structure) == 0 {
+		return nil
+	}
+	return scheduler.Scale(r.App, structure)
 }
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"io"
+)
+
+// Scheduler runs applications on a cluster. The API never talks to the cluster directly; every
+// app and release is handed to a Scheduler instead, which makes it possible to swap the real
+// cluster out for a fake one in tests.
+type Scheduler interface {
+	// CreateApp prepares the cluster for a new app, such as creating a namespace for it.
+	CreateApp(app *App) error
+	// Deploy runs every process type in the release's Procfile.
+	Deploy(release *Release) error
+	// Scale sets the number of processes that should be running for each process type.
+	Scale(app *App, structure map[string]int) error
+	// SetDomains routes traffic for every domain in app.Domains to the app's web processes, and
+	// stops routing domains which are no longer in it. Domains covered by one of app.Certs are
+	// served over HTTPS.
+	SetDomains(app *App) error
+	// SetCert stores a certificate and its key for the app. Certificates with different
+	// fingerprints are stored side by side, even if they share a name, so a replacement can be
+	// stored before SetDomains puts it to use and the certificate it replaces removed after.
+	SetCert(app *App, cert *Cert) error
+	// RemoveCert deletes a certificate stored by SetCert.
+	RemoveCert(app *App, cert *Cert) error
+	// DeleteApp removes everything the scheduler created for the app. The removal may still be
+	// in progress when DeleteApp returns; AppDeleted reports when it is done.
+	DeleteApp(app *App) error
+	// AppDeleted reports whether everything the scheduler created for the app is gone.
+	AppDeleted(app *App) (bool, error)
+	// Logs returns the logs of the app's processes, prefixed by the process each line came from.
+	// When following, the returned stream stays open until it is closed by the caller.
+	Logs(app *App, opts LogOptions) (io.ReadCloser, error)
+	// Run starts a one-off process which runs command in a shell, using the release's build and
+	// config, and returns once the process has started.
+	Run(release *Release, command string) (OneOff, error)
+	// Exec runs command in one of the app's running processes, attached to a terminal. It fails
+	// with a NotFoundError if the app has no process by that name.
+	Exec(app *App, process string, command []string) (Terminal, error)
+	// Processes lists the app's processes of every process type. One-off processes are left out.
+	Processes(app *App) ([]*Process, error)
+	// RestartProcess stops one of the app's processes, which is replaced by a new one for the
+	// same release. It fails with a NotFoundError if the app has no process by that name.
+	RestartProcess(app *App, name string) error
+	// Restart replaces the processes of one process type of the release, or of every type if typ
+	// is empty, a few at a time so that the app stays up. The number of processes of each type is
+	// kept. Progress is written to progress as lines of text, and Restart returns once every new
+	// process is up, or with an error once ctx is done.
+	Restart(ctx context.Context, release *Release, typ string, progress io.Writer) error
+}
+
+// OneOff is a one-off process started by Scheduler.Run. Reading it streams what the process
+// writes to stdout and stderr until the process exits. Closing it stops the process if it is
+// still running, and removes it from the cluster.
+type OneOff interface {
+	io.ReadCloser
+	// ExitCode waits for the process to exit and returns its exit code. It is meant to be called
+	// once the output has been read to the end.
+	ExitCode() (int, error)
+}
+
+// Terminal is an interactive session started by Scheduler.Exec. Writing to it sends input to the
+// command, and reading it streams what the command writes to the terminal until the command exits.
+// Closing it ends the session.
+type Terminal interface {
+	io.ReadWriteCloser
+	// Resize changes the size of the terminal, in characters.
+	Resize(width, height uint16) error
+}
+
+// LogOptions narrows down which logs are returned by Scheduler.Logs.
+type LogOptions struct {
+	// Type restricts the logs to processes of a single process type.
+	Type string
+	// Lines is the number of most recent lines to return per process. Zero returns everything.
+	Lines int
+	// Follow keeps the stream open, sending new lines as the processes write them.
+	Follow bool
+}
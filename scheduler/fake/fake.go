@@ -0,0 +1,405 @@
+// Package fake provides an in-process api.Scheduler which records every call made to it, so the
+// API can be exercised without a cluster.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fishworks/api"
+)
+
+// Call is a single recorded call to the Scheduler.
+type Call struct {
+	// Method is the name of the Scheduler method that was called, e.g. "Deploy".
+	Method string
+	// App is the ID of the app the call was made for.
+	App string
+	// Release is the version of the release passed to Deploy.
+	Release int
+	// Structure is the structure passed to Scale.
+	Structure map[string]int
+	// LogOptions are the options passed to Logs.
+	LogOptions api.LogOptions
+	// Domains are the app's domains when SetDomains was called.
+	Domains []string
+	// Cert is the name of the certificate passed to SetCert or RemoveCert.
+	Cert string
+	// Fingerprint is the fingerprint of the certificate passed to SetCert or RemoveCert.
+	Fingerprint string
+	// Command is the command passed to Run or Exec. The arguments passed to Exec are joined by
+	// spaces.
+	Command string
+	// Process is the name of the process passed to Exec or RestartProcess.
+	Process string
+	// Type is the process type passed to Restart.
+	Type string
+}
+
+// Scheduler is a fake api.Scheduler. The zero value is ready to use.
+type Scheduler struct {
+	mu        sync.Mutex
+	calls     []Call
+	terminals []*Terminal
+	// Err, when set, is returned by every call.
+	Err error
+	// LogLines holds the log lines returned by Logs, keyed by app ID.
+	LogLines map[string][]string
+	// Apps holds the IDs of the apps which currently exist on the scheduler.
+	Apps map[string]bool
+	// Releases holds the release which was last deployed for each app.
+	Releases map[string]*api.Release
+	// Terminating holds the IDs of the apps which never finish being deleted, to simulate a
+	// teardown which is stuck.
+	Terminating map[string]bool
+	// KeepFollowing, when set, keeps followed logs open once LogLines have been read, like a
+	// real cluster does, until the stream is closed.
+	KeepFollowing bool
+	// RunOutput and RunExitCode are the output and exit code of every one-off process started
+	// by Run.
+	RunOutput   string
+	RunExitCode int
+	// RunDone, when set, keeps one-off processes running once they have written RunOutput, until
+	// it is closed or they are.
+	RunDone chan struct{}
+	// Removed holds the commands of the one-off processes which were closed, in order.
+	Removed []string
+	// ProcessList holds the running processes of each app, keyed by app ID. They are listed by
+	// Processes and accepted by Exec and RestartProcess.
+	ProcessList map[string][]*api.Process
+}
+
+// New creates a new fake Scheduler.
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Calls returns every call made to the scheduler so far, in order.
+func (s *Scheduler) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+	return calls
+}
+
+// CallsTo returns every call made to the named method so far, in order.
+func (s *Scheduler) CallsTo(method string) []Call {
+	var calls []Call
+	for _, c := range s.Calls() {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Terminals returns every terminal opened by Exec so far, in order.
+func (s *Scheduler) Terminals() []*Terminal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Terminal(nil), s.terminals...)
+}
+
+// CreateApp records the app as existing on the scheduler.
+func (s *Scheduler) CreateApp(app *api.App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "CreateApp", App: app.ID})
+	if s.Err != nil {
+		return s.Err
+	}
+	if s.Apps == nil {
+		s.Apps = make(map[string]bool)
+	}
+	s.Apps[app.ID] = true
+	return nil
+}
+
+// Deploy records the release as the one running for its app.
+func (s *Scheduler) Deploy(release *api.Release) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "Deploy", App: release.App.ID, Release: release.Version})
+	if s.Err != nil {
+		return s.Err
+	}
+	if s.Releases == nil {
+		s.Releases = make(map[string]*api.Release)
+	}
+	s.Releases[release.App.ID] = release
+	return nil
+}
+
+// Scale records the structure the app was scaled to.
+func (s *Scheduler) Scale(app *api.App, structure map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := make(map[string]int, len(structure))
+	for typ, n := range structure {
+		copied[typ] = n
+	}
+	s.calls = append(s.calls, Call{Method: "Scale", App: app.ID, Structure: copied})
+	return s.Err
+}
+
+// SetDomains records the domains routed to the app.
+func (s *Scheduler) SetDomains(app *api.App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "SetDomains", App: app.ID, Domains: append([]string(nil), app.Domains...)})
+	return s.Err
+}
+
+// SetCert records the certificate stored for the app.
+func (s *Scheduler) SetCert(app *api.App, cert *api.Cert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "SetCert", App: app.ID, Cert: cert.Name, Fingerprint: cert.Fingerprint})
+	return s.Err
+}
+
+// RemoveCert records the certificate removed from the app.
+func (s *Scheduler) RemoveCert(app *api.App, cert *api.Cert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "RemoveCert", App: app.ID, Cert: cert.Name, Fingerprint: cert.Fingerprint})
+	return s.Err
+}
+
+// DeleteApp forgets the app and its running release.
+func (s *Scheduler) DeleteApp(app *api.App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "DeleteApp", App: app.ID})
+	if s.Err != nil {
+		return s.Err
+	}
+	delete(s.Apps, app.ID)
+	delete(s.Releases, app.ID)
+	return nil
+}
+
+// AppDeleted reports whether the app was deleted, unless it is stuck in Terminating.
+func (s *Scheduler) AppDeleted(app *api.App) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "AppDeleted", App: app.ID})
+	if s.Err != nil {
+		return false, s.Err
+	}
+	return !s.Apps[app.ID] && !s.Terminating[app.ID], nil
+}
+
+// Logs returns the app's entries in LogLines. Following the logs returns the same lines; the
+// stream ends once they have been read, unless KeepFollowing is set.
+func (s *Scheduler) Logs(app *api.App, opts api.LogOptions) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "Logs", App: app.ID, LogOptions: opts})
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	lines := s.LogLines[app.ID]
+	if opts.Lines > 0 && opts.Lines < len(lines) {
+		lines = lines[len(lines)-opts.Lines:]
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(strings.TrimSuffix(line, "\n") + "\n")
+	}
+	if opts.Follow && s.KeepFollowing {
+		// the pipe's writer is never closed, so reads block once the lines are consumed
+		pr, pw := io.Pipe()
+		go buf.WriteTo(pw)
+		return pr, nil
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+// Run starts a one-off process which writes RunOutput and exits with RunExitCode.
+func (s *Scheduler) Run(release *api.Release, command string) (api.OneOff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "Run", App: release.App.ID, Release: release.Version, Command: command})
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	var output io.Reader = strings.NewReader(s.RunOutput)
+	if s.RunDone != nil {
+		pr, pw := io.Pipe()
+		go func(text string, done <-chan struct{}) {
+			io.WriteString(pw, text)
+			<-done
+			pw.Close()
+		}(s.RunOutput, s.RunDone)
+		output = pr
+	}
+	return &oneOff{
+		Reader:   output,
+		s:        s,
+		command:  command,
+		exitCode: s.RunExitCode,
+	}, nil
+}
+
+// oneOff is a one-off process started by the fake Scheduler.
+type oneOff struct {
+	io.Reader
+	s        *Scheduler
+	command  string
+	exitCode int
+	closed   bool
+}
+
+func (o *oneOff) ExitCode() (int, error) {
+	return o.exitCode, nil
+}
+
+// Close records the process as removed, the first time it is called.
+func (o *oneOff) Close() error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		o.s.Removed = append(o.s.Removed, o.command)
+		if pr, ok := o.Reader.(*io.PipeReader); ok {
+			pr.Close()
+		}
+	}
+	return nil
+}
+
+// Exec opens a Terminal in one of the app's processes in ProcessList.
+func (s *Scheduler) Exec(app *api.App, process string, command []string) (api.Terminal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "Exec", App: app.ID, Process: process, Command: strings.Join(command, " ")})
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	for _, proc := range s.ProcessList[app.ID] {
+		if proc.Name == process {
+			pr, pw := io.Pipe()
+			t := &Terminal{pr: pr, pw: pw}
+			s.terminals = append(s.terminals, t)
+			return t, nil
+		}
+	}
+	return nil, &api.NotFoundError{Kind: "process", ID: process}
+}
+
+// Processes returns the app's entries in ProcessList.
+func (s *Scheduler) Processes(app *api.App) ([]*api.Process, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "Processes", App: app.ID})
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return append([]*api.Process(nil), s.ProcessList[app.ID]...), nil
+}
+
+// RestartProcess removes the process from ProcessList. Unlike on a cluster, nothing replaces it.
+func (s *Scheduler) RestartProcess(app *api.App, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "RestartProcess", App: app.ID, Process: name})
+	if s.Err != nil {
+		return s.Err
+	}
+	procs := s.ProcessList[app.ID]
+	for i, proc := range procs {
+		if proc.Name == name {
+			s.ProcessList[app.ID] = append(procs[:i:i], procs[i+1:]...)
+			return nil
+		}
+	}
+	return &api.NotFoundError{Kind: "process", ID: name}
+}
+
+// Restart writes a line of progress for each process type it restarts. It fails if ctx is
+// already done.
+func (s *Scheduler) Restart(ctx context.Context, release *api.Release, typ string, progress io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{Method: "Restart", App: release.App.ID, Release: release.Version, Type: typ})
+	if s.Err != nil {
+		return s.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	types := []string{typ}
+	if typ == "" {
+		types = nil
+		for t := range release.Build.Procfile {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+	}
+	for _, t := range types {
+		fmt.Fprintf(progress, "%s: restarted\n", t)
+	}
+	return nil
+}
+
+// Terminal is a terminal opened by the fake Scheduler. It echoes its input back, like cat, and
+// the command exits once it is sent "exit\n".
+type Terminal struct {
+	pr *io.PipeReader
+	pw *io.PipeWriter
+
+	mu     sync.Mutex
+	sizes  [][2]uint16
+	closed bool
+}
+
+func (t *Terminal) Read(b []byte) (int, error) {
+	return t.pr.Read(b)
+}
+
+func (t *Terminal) Write(b []byte) (int, error) {
+	if string(b) == "exit\n" {
+		t.pw.Close()
+		return len(b), nil
+	}
+	return t.pw.Write(b)
+}
+
+// Resize records the size of the terminal.
+func (t *Terminal) Resize(width, height uint16) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sizes = append(t.sizes, [2]uint16{width, height})
+	return nil
+}
+
+// Sizes returns the width and height of every resize, in order.
+func (t *Terminal) Sizes() [][2]uint16 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([][2]uint16(nil), t.sizes...)
+}
+
+// Close ends the session.
+func (t *Terminal) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.pr.Close()
+	return t.pw.Close()
+}
+
+// Closed reports whether the session was ended.
+func (t *Terminal) Closed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
@@ -0,0 +1,169 @@
+package k8s
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fishworks/api"
+	"github.com/gorilla/websocket"
+	kerrors "k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/rest"
+)
+
+// The channels of the Kubernetes remote command protocol. Every WebSocket message starts with
+// the byte of the channel it belongs to.
+const (
+	stdinChannel byte = iota
+	stdoutChannel
+	stderrChannel
+	errorChannel
+	resizeChannel
+)
+
+// execProtocols are the WebSocket subprotocols spoken by Exec, most preferred first. Only
+// v4.channel.k8s.io carries resize messages; older clusters ignore them.
+var execProtocols = []string{"v4.channel.k8s.io", "channel.k8s.io"}
+
+// execHandshakeTimeout is how long the API server may take to accept an exec session.
+const execHandshakeTimeout = 30 * time.Second
+
+// Exec runs command in the first container of the named pod, with a TTY, through the pod's exec
+// subresource. The session is a WebSocket to the API server.
+func (s *Scheduler) Exec(app *api.App, process string, command []string) (api.Terminal, error) {
+	pod, err := s.client.Core().Pods(app.ID).Get(process)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, &api.NotFoundError{Kind: "process", ID: process}
+		}
+		return nil, err
+	}
+	req := s.client.Core().GetRESTClient().Post().
+		Namespace(app.ID).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		Param("container", pod.Spec.Containers[0].Name).
+		Param("stdin", "true").
+		Param("stdout", "true").
+		Param("tty", "true")
+	for _, arg := range command {
+		req = req.Param("command", arg)
+	}
+	u := req.URL()
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	tlsConfig, err := rest.TLSConfigFor(s.config)
+	if err != nil {
+		return nil, err
+	}
+	dialer := websocket.Dialer{
+		TLSClientConfig:  tlsConfig,
+		Subprotocols:     execProtocols,
+		HandshakeTimeout: execHandshakeTimeout,
+	}
+	header := http.Header{}
+	if s.config.BearerToken != "" {
+		header.Set("Authorization", "Bearer "+s.config.BearerToken)
+	}
+	conn, _, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	return &terminal{conn: conn}, nil
+}
+
+// terminal is an exec session with a container, multiplexed over a WebSocket to the API server.
+type terminal struct {
+	conn *websocket.Conn
+	// mu serializes writes, since input and resizes may come from different goroutines.
+	mu sync.Mutex
+	// buf holds output which was received but not read yet.
+	buf []byte
+}
+
+// Read returns the output of the command. With a TTY, stderr is merged into stdout. Reading ends
+// with io.EOF once the command exits, whatever its exit code.
+func (t *terminal) Read(b []byte) (int, error) {
+	for len(t.buf) == 0 {
+		_, msg, err := t.conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		switch msg[0] {
+		case stdoutChannel, stderrChannel:
+			t.buf = msg[1:]
+		case errorChannel:
+			if err := execStatusError(msg[1:]); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
+
+func (t *terminal) Write(b []byte) (int, error) {
+	if err := t.send(stdinChannel, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (t *terminal) Resize(width, height uint16) error {
+	size, err := json.Marshal(struct {
+		Width  uint16
+		Height uint16
+	}{width, height})
+	if err != nil {
+		return err
+	}
+	return t.send(resizeChannel, size)
+}
+
+func (t *terminal) Close() error {
+	return t.conn.Close()
+}
+
+// send writes data to one of the channels of the session.
+func (t *terminal) send(channel byte, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, data...))
+}
+
+// execStatusError returns the error described by the status sent on the error channel when the
+// command exits. A non-zero exit code is not an error of the session. Before v4, the error channel
+// carries a plain message instead of a status.
+func execStatusError(msg []byte) error {
+	if len(msg) == 0 {
+		return nil
+	}
+	var status struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.Unmarshal(msg, &status); err != nil {
+		return errors.New(string(msg))
+	}
+	if status.Status == "Success" || status.Reason == "NonZeroExitCode" {
+		return nil
+	}
+	return errors.New(status.Message)
+}
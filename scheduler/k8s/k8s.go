@@ -0,0 +1,437 @@
+// Package k8s schedules apps onto a Kubernetes cluster.
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"k8s.io/client-go/1.4/kubernetes"
+	kapi "k8s.io/client-go/1.4/pkg/api"
+	kerrors "k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/pkg/api/resource"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.4/pkg/labels"
+	"k8s.io/client-go/1.4/pkg/util/intstr"
+	"k8s.io/client-go/1.4/rest"
+)
+
+// revisionHistoryLimit is the number of old replica sets kept around for each deployment, so
+// that a bad release can be rolled back on the cluster.
+const revisionHistoryLimit = 10
+
+// Scheduler is an api.Scheduler backed by a Kubernetes cluster. Every app lives in a namespace
+// named after the app, and every process type of the app is managed by a Deployment named
+// <app>-<type>. Publishing a release updates the pod template of each deployment, which rolls
+// the processes over to the new release and retires the previous release's pods.
+type Scheduler struct {
+	client *kubernetes.Clientset
+	config *rest.Config
+}
+
+// New creates a Scheduler for the cluster this process is running in.
+func New() (*Scheduler, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewForConfig(config)
+}
+
+// NewForConfig creates a Scheduler for the cluster described by config.
+func NewForConfig(config *rest.Config) (*Scheduler, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{client: clientset, config: config}, nil
+}
+
+// CreateApp creates a namespace for the app, labelled as belonging to it. It is not an error if
+// the namespace already exists and belongs to the app, unless it is still being deleted. A
+// namespace which exists for anything else is never taken over.
+func (s *Scheduler) CreateApp(app *api.App) error {
+	namespace := &v1types.Namespace{
+		ObjectMeta: v1types.ObjectMeta{
+			Name: app.ID,
+			Labels: map[string]string{
+				"heritage": "deis",
+				"app":      app.ID,
+			},
+		},
+	}
+	_, err := s.client.Core().Namespaces().Create(namespace)
+	if err == nil {
+		return nil
+	}
+	if !kerrors.IsAlreadyExists(err) {
+		return err
+	}
+	existing, err := s.client.Core().Namespaces().Get(app.ID)
+	if err != nil {
+		return err
+	}
+	if !ownsNamespace(app, existing) {
+		return &api.ConflictError{Kind: "app", Message: fmt.Sprintf("namespace %s already exists and does not belong to an app", app.ID)}
+	}
+	if existing.Status.Phase == v1types.NamespaceTerminating {
+		return fmt.Errorf("app %s is still being deleted", app.ID)
+	}
+	return nil
+}
+
+// ownsNamespace reports whether the namespace was created for the app by CreateApp.
+func ownsNamespace(app *api.App, namespace *v1types.Namespace) bool {
+	return namespace.Labels["heritage"] == "deis" && namespace.Labels["app"] == app.ID
+}
+
+// Deploy creates or updates a deployment for every process type in the release's Procfile and
+// removes the deployments of process types which are no longer in it. If any step fails, the
+// deployments which were already updated are rolled back to their previous revision, and those
+// created for process types new to this release are removed; deployments which were already
+// pruned are not brought back. The web service is created along with the web process, and
+// removed along with it.
+func (s *Scheduler) Deploy(release *api.Release) error {
+	if _, err := webPort(release); err != nil {
+		return err
+	}
+	var updated, created []string
+	for typ := range release.Build.Procfile {
+		isNew, err := s.deploy(release, typ)
+		if err != nil {
+			s.rollback(release.App, updated, created)
+			return err
+		}
+		if isNew {
+			created = append(created, typ)
+		} else {
+			updated = append(updated, typ)
+		}
+	}
+	err := s.syncService(release)
+	if err == nil {
+		err = s.prune(release)
+	}
+	if err != nil {
+		s.rollback(release.App, updated, created)
+		return err
+	}
+	return nil
+}
+
+// Scale sets the number of replicas of each process type's deployment.
+func (s *Scheduler) Scale(app *api.App, structure map[string]int) error {
+	deployments := s.client.Extensions().Deployments(app.ID)
+	for typ, replicas := range structure {
+		deployment, err := deployments.Get(deploymentName(app, typ))
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				return fmt.Errorf("process type %s is not deployed", typ)
+			}
+			return err
+		}
+		n := int32(replicas)
+		deployment.Spec.Replicas = &n
+		if _, err := deployments.Update(deployment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteApp deletes the app's namespace, which takes every resource inside it along with it.
+// Kubernetes deletes the namespace in the background: it stays around in the Terminating phase
+// until all of its pods are gone. A namespace which was not created for the app is never deleted.
+func (s *Scheduler) DeleteApp(app *api.App) error {
+	namespace, err := s.client.Core().Namespaces().Get(app.ID)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !ownsNamespace(app, namespace) {
+		return fmt.Errorf("namespace %s does not belong to app %s", app.ID, app.ID)
+	}
+	if err := s.client.Core().Namespaces().Delete(app.ID, &kapi.DeleteOptions{}); err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// AppDeleted reports whether the app's namespace is gone.
+func (s *Scheduler) AppDeleted(app *api.App) (bool, error) {
+	_, err := s.client.Core().Namespaces().Get(app.ID)
+	if err == nil {
+		return false, nil
+	}
+	if kerrors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// Logs collects the container logs of the app's pods. Without following, the logs of each pod
+// are streamed one after the other; when following, lines are multiplexed as they arrive. Only
+// the pods which exist when Logs is called are followed: pods started afterwards, such as by a
+// deploy or a scale, are not picked up.
+func (s *Scheduler) Logs(app *api.App, opts api.LogOptions) (io.ReadCloser, error) {
+	pods, err := s.pods(app, opts.Type)
+	if err != nil {
+		return nil, err
+	}
+	logOpts := &v1types.PodLogOptions{Follow: opts.Follow}
+	if opts.Lines > 0 {
+		lines := int64(opts.Lines)
+		logOpts.TailLines = &lines
+	}
+
+	if !opts.Follow {
+		names := make([]string, len(pods))
+		for i, pod := range pods {
+			names[i] = pod.Name
+		}
+		return newSequentialLogs(names, func(pod string) (io.ReadCloser, error) {
+			return s.client.Core().Pods(app.ID).GetLogs(pod, logOpts).Stream()
+		}), nil
+	}
+
+	logs := newLogStream()
+	for _, pod := range pods {
+		stream, err := s.client.Core().Pods(app.ID).GetLogs(pod.Name, logOpts).Stream()
+		if err != nil {
+			logs.Close()
+			return nil, err
+		}
+		logs.add(pod.Name, stream)
+	}
+	logs.start()
+	return logs, nil
+}
+
+// pods lists the app's pods, optionally narrowed down to a single process type.
+func (s *Scheduler) pods(app *api.App, typ string) ([]v1types.Pod, error) {
+	selector := labels.Set{"app": app.ID}
+	if typ != "" {
+		selector["type"] = typ
+	}
+	list, err := s.client.Core().Pods(app.ID).List(kapi.ListOptions{LabelSelector: selector.AsSelector()})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// deploy creates the deployment for a process type of the release, or points the existing
+// deployment at the release, which triggers a rolling update. It reports whether the deployment
+// was created.
+func (s *Scheduler) deploy(release *api.Release, typ string) (bool, error) {
+	deployments := s.client.Extensions().Deployments(release.App.ID)
+	deployment, err := deployments.Get(deploymentName(release.App, typ))
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			return false, err
+		}
+		_, err = deployments.Create(deploymentFor(release, typ))
+		return err == nil, err
+	}
+	deployment.Spec.Template = podTemplateFor(release, typ)
+	_, err = deployments.Update(deployment)
+	return false, err
+}
+
+// rollback returns the deployments of the updated process types to their previous revision, and
+// removes those of the created process types, which have no previous revision.
+func (s *Scheduler) rollback(app *api.App, updated, created []string) {
+	for _, typ := range updated {
+		rollback := &v1beta1.DeploymentRollback{Name: deploymentName(app, typ)}
+		if err := s.client.Extensions().Deployments(app.ID).Rollback(rollback); err != nil {
+			log.Errorf("could not roll back %s: %v", rollback.Name, err)
+		}
+	}
+	for _, typ := range created {
+		if err := s.removeDeployment(app, typ); err != nil {
+			log.Errorf("could not remove %s: %v", deploymentName(app, typ), err)
+		}
+	}
+}
+
+// prune removes the deployments, replica sets and pods of every process type of the app which
+// is not in the release's Procfile.
+func (s *Scheduler) prune(release *api.Release) error {
+	app := release.App
+	selector := labels.Set{"app": app.ID}.AsSelector()
+	list, err := s.client.Extensions().Deployments(app.ID).List(kapi.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+	for _, typ := range staleTypes(list.Items, release.Build.Procfile) {
+		if err := s.removeDeployment(app, typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staleTypes returns the process types of the deployments which are not in the Procfile.
+func staleTypes(deployments []v1beta1.Deployment, procfile map[string][]string) []string {
+	var stale []string
+	for _, deployment := range deployments {
+		typ := deployment.Labels["type"]
+		if _, ok := procfile[typ]; !ok {
+			stale = append(stale, typ)
+		}
+	}
+	return stale
+}
+
+// removeDeployment removes the deployment of a process type along with its replica sets and
+// pods. Deleting a deployment does not delete its replica sets and pods, so it is scaled down
+// first and cleaned up after.
+func (s *Scheduler) removeDeployment(app *api.App, typ string) error {
+	deployments := s.client.Extensions().Deployments(app.ID)
+	deployment, err := deployments.Get(deploymentName(app, typ))
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	var zero int32
+	deployment.Spec.Replicas = &zero
+	if _, err := deployments.Update(deployment); err != nil {
+		return err
+	}
+	if err := deployments.Delete(deployment.Name, &kapi.DeleteOptions{}); err != nil {
+		return err
+	}
+	typeSelector := kapi.ListOptions{LabelSelector: labels.Set{"app": app.ID, "type": typ}.AsSelector()}
+	if err := s.client.Extensions().ReplicaSets(app.ID).DeleteCollection(&kapi.DeleteOptions{}, typeSelector); err != nil {
+		return err
+	}
+	return s.client.Core().Pods(app.ID).DeleteCollection(&kapi.DeleteOptions{}, typeSelector)
+}
+
+// deploymentName returns the name of the deployment managing a process type. Process types may
+// contain characters which are not valid in a DNS label, such as underscores.
+func deploymentName(app *api.App, typ string) string {
+	return fmt.Sprintf("%s-%s", app.ID, dnsLabel(typ))
+}
+
+func dnsLabel(s string) string {
+	return strings.Replace(strings.ToLower(s), "_", "-", -1)
+}
+
+// deploymentFor builds a new deployment for the given process type, scaled to the app's
+// structure.
+func deploymentFor(release *api.Release, typ string) *v1beta1.Deployment {
+	replicas := int32(1)
+	if n, ok := release.App.Structure[typ]; ok {
+		replicas = int32(n)
+	}
+	historyLimit := int32(revisionHistoryLimit)
+	maxUnavailable := intstr.FromInt(0)
+	maxSurge := intstr.FromInt(1)
+	return &v1beta1.Deployment{
+		ObjectMeta: v1types.ObjectMeta{
+			Name:      deploymentName(release.App, typ),
+			Namespace: release.App.ID,
+			Labels: map[string]string{
+				"heritage": "deis",
+				"app":      release.App.ID,
+				"type":     typ,
+			},
+		},
+		Spec: v1beta1.DeploymentSpec{
+			Replicas: &replicas,
+			// the selector must not include the version, otherwise the pods of the next release
+			// would not be selected.
+			Selector: &v1beta1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app":  release.App.ID,
+					"type": typ,
+				},
+			},
+			Template: podTemplateFor(release, typ),
+			Strategy: v1beta1.DeploymentStrategy{
+				Type: v1beta1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &v1beta1.RollingUpdateDeployment{
+					MaxUnavailable: &maxUnavailable,
+					MaxSurge:       &maxSurge,
+				},
+			},
+			RevisionHistoryLimit: &historyLimit,
+		},
+	}
+}
+
+// podTemplateFor builds the pod template which runs the given process type of a release. Web
+// processes expose the port the web service sends traffic to, which is passed to them as PORT
+// unless the app sets it.
+func podTemplateFor(release *api.Release, typ string) v1types.PodTemplateSpec {
+	var env []v1types.EnvVar
+	if release.Config != nil {
+		// copy the values, since the config is shared with the release
+		env = append(env, release.Config.Values...)
+	}
+	container := v1types.Container{
+		Name:            dnsLabel(typ),
+		Image:           release.Build.Image,
+		ImagePullPolicy: v1types.PullAlways,
+		Command:         release.Build.Procfile[typ],
+		Resources:       resourcesFor(release.Limits[typ]),
+	}
+	if typ == webType {
+		// Deploy checks that PORT is valid before building any pod template
+		port, _ := webPort(release)
+		container.Ports = []v1types.ContainerPort{
+			v1types.ContainerPort{Name: "http", ContainerPort: int32(port), Protocol: v1types.ProtocolTCP},
+		}
+		if _, ok := release.Config.Get("PORT"); !ok {
+			env = append(env, v1types.EnvVar{Name: "PORT", Value: strconv.Itoa(port)})
+		}
+	}
+	container.Env = env
+	return v1types.PodTemplateSpec{
+		ObjectMeta: v1types.ObjectMeta{
+			Labels: map[string]string{
+				"heritage": "deis",
+				"app":      release.App.ID,
+				"type":     typ,
+				"version":  fmt.Sprintf("v%d", release.Version),
+			},
+		},
+		Spec: v1types.PodSpec{
+			RestartPolicy: v1types.RestartPolicyAlways,
+			Containers:    []v1types.Container{container},
+		},
+	}
+}
+
+// resourcesFor builds the resource requirements of a process type's containers. The amounts were
+// validated when the limits were set.
+func resourcesFor(res api.Resources) v1types.ResourceRequirements {
+	return v1types.ResourceRequirements{
+		Requests: resourceList(res.CPURequest, res.MemoryRequest),
+		Limits:   resourceList(res.CPULimit, res.MemoryLimit),
+	}
+}
+
+// resourceList returns the given amounts of CPU and memory, leaving out those which are empty.
+func resourceList(cpu, memory string) v1types.ResourceList {
+	list := v1types.ResourceList{}
+	if cpu != "" {
+		list[v1types.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		list[v1types.ResourceMemory] = resource.MustParse(memory)
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
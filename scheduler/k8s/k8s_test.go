@@ -0,0 +1,91 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fishworks/api"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+)
+
+func TestOwnsNamespace(t *testing.T) {
+	app := &api.App{ID: "autotest"}
+	tests := []struct {
+		labels map[string]string
+		owned  bool
+	}{
+		{map[string]string{"heritage": "deis", "app": "autotest"}, true},
+		// created for another app, or before namespaces were labelled with their app
+		{map[string]string{"heritage": "deis", "app": "other"}, false},
+		{map[string]string{"heritage": "deis"}, false},
+		// not created by the API at all, such as kube-system or another tenant's namespace
+		{map[string]string{"app": "autotest"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		namespace := &v1types.Namespace{ObjectMeta: v1types.ObjectMeta{Name: "autotest", Labels: tt.labels}}
+		if owned := ownsNamespace(app, namespace); owned != tt.owned {
+			t.Errorf("%v: expected owned=%t, got %t", tt.labels, tt.owned, owned)
+		}
+	}
+}
+
+func TestDeploymentFor(t *testing.T) {
+	app := &api.App{ID: "autotest", Structure: map[string]int{"web": 3}}
+	release := &api.Release{
+		App:     app,
+		Version: 4,
+		Build: &api.Build{
+			Image:    "deis/example-go:latest",
+			Procfile: map[string][]string{"web": {"./web"}, "background_worker": {"./worker"}},
+		},
+	}
+	tests := []struct {
+		typ      string
+		name     string
+		replicas int32
+	}{
+		{"web", "autotest-web", 3},
+		// types which were never scaled run a single process, and are named as DNS labels
+		{"background_worker", "autotest-background-worker", 1},
+	}
+	for _, tt := range tests {
+		deployment := deploymentFor(release, tt.typ)
+		if deployment.Name != tt.name || deployment.Namespace != "autotest" {
+			t.Errorf("%s: expected deployment autotest/%s, got %s/%s", tt.typ, tt.name, deployment.Namespace, deployment.Name)
+		}
+		if *deployment.Spec.Replicas != tt.replicas {
+			t.Errorf("%s: expected %d replicas, got %d", tt.typ, tt.replicas, *deployment.Spec.Replicas)
+		}
+		// the next release's pods must still be selected
+		selector := map[string]string{"app": "autotest", "type": tt.typ}
+		if !reflect.DeepEqual(deployment.Spec.Selector.MatchLabels, selector) {
+			t.Errorf("%s: expected selector %v, got %v", tt.typ, selector, deployment.Spec.Selector.MatchLabels)
+		}
+		if v := deployment.Spec.Template.Labels["version"]; v != "v4" {
+			t.Errorf("%s: expected the pods to be labelled with v4, got %q", tt.typ, v)
+		}
+		if u := deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue(); u != 0 {
+			t.Errorf("%s: expected no process to be unavailable during updates, got %d", tt.typ, u)
+		}
+		container := deployment.Spec.Template.Spec.Containers[0]
+		if container.Image != "deis/example-go:latest" || !reflect.DeepEqual(container.Command, release.Build.Procfile[tt.typ]) {
+			t.Errorf("%s: expected the container to run the Procfile command, got %+v", tt.typ, container)
+		}
+	}
+}
+
+func TestStaleTypes(t *testing.T) {
+	deployment := func(typ string) v1beta1.Deployment {
+		return v1beta1.Deployment{ObjectMeta: v1types.ObjectMeta{Labels: map[string]string{"app": "autotest", "type": typ}}}
+	}
+	deployments := []v1beta1.Deployment{deployment("web"), deployment("worker"), deployment("clock")}
+	stale := staleTypes(deployments, map[string][]string{"web": {"./web"}, "clock": {"./clock"}})
+	if !reflect.DeepEqual(stale, []string{"worker"}) {
+		t.Errorf("expected only worker to be pruned, got %v", stale)
+	}
+	if stale := staleTypes(deployments, map[string][]string{"web": nil, "worker": nil, "clock": nil}); len(stale) != 0 {
+		t.Errorf("expected nothing to be pruned, got %v", stale)
+	}
+}
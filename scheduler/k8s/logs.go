@@ -0,0 +1,112 @@
+package k8s
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// copyLines copies every line from r to w, prefixed with the name of the pod it came from.
+func copyLines(w io.Writer, pod string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", pod, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// sequentialLogs streams the logs of several pods one after the other. A pod's log is only
+// requested once the previous pod's has been read, so the logs are never held in memory.
+type sequentialLogs struct {
+	r    *io.PipeReader
+	w    *io.PipeWriter
+	open func(pod string) (io.ReadCloser, error)
+}
+
+// newSequentialLogs starts streaming the logs of the pods, which open requests one at a time.
+func newSequentialLogs(pods []string, open func(pod string) (io.ReadCloser, error)) *sequentialLogs {
+	r, w := io.Pipe()
+	l := &sequentialLogs{r: r, w: w, open: open}
+	go l.copy(pods)
+	return l
+}
+
+// copy writes the log of each pod in turn, and ends the stream with the first error.
+func (l *sequentialLogs) copy(pods []string) {
+	for _, pod := range pods {
+		stream, err := l.open(pod)
+		if err != nil {
+			l.w.CloseWithError(err)
+			return
+		}
+		err = copyLines(l.w, pod, stream)
+		stream.Close()
+		if err != nil {
+			l.w.CloseWithError(err)
+			return
+		}
+	}
+	l.w.Close()
+}
+
+func (l *sequentialLogs) Read(p []byte) (int, error) {
+	return l.r.Read(p)
+}
+
+// Close stops streaming. The pod being read is let go of once its next line is written.
+func (l *sequentialLogs) Close() error {
+	return l.r.Close()
+}
+
+// logStream multiplexes the followed log streams of several pods into a single stream. It ends
+// once every pod's stream has ended, or when it is closed.
+type logStream struct {
+	r       *io.PipeReader
+	w       *io.PipeWriter
+	streams []io.ReadCloser
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+func newLogStream() *logStream {
+	r, w := io.Pipe()
+	return &logStream{r: r, w: w}
+}
+
+// add starts copying a pod's stream into the log stream.
+func (l *logStream) add(pod string, stream io.ReadCloser) {
+	l.streams = append(l.streams, stream)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		// writes to a pipe are serialized and each one is read in full before the next one
+		// starts, so lines from different pods never interleave.
+		copyLines(l.w, pod, stream)
+	}()
+}
+
+// start closes the write side of the stream once every pod's stream has ended.
+func (l *logStream) start() {
+	go func() {
+		l.wg.Wait()
+		l.w.Close()
+	}()
+}
+
+func (l *logStream) Read(p []byte) (int, error) {
+	return l.r.Read(p)
+}
+
+// Close stops following every pod's stream. It is safe to call more than once.
+func (l *logStream) Close() error {
+	l.once.Do(func() {
+		l.r.Close()
+		for _, stream := range l.streams {
+			stream.Close()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLogStreamMultiplexesPods(t *testing.T) {
+	logs := newLogStream()
+	logs.add("autotest-web-1", ioutil.NopCloser(strings.NewReader("one\ntwo\n")))
+	logs.add("autotest-worker-1", ioutil.NopCloser(strings.NewReader("three\n")))
+	logs.start()
+	b, err := ioutil.ReadAll(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"autotest-web-1: one\n", "autotest-web-1: two\n", "autotest-worker-1: three\n"} {
+		if !strings.Contains(string(b), line) {
+			t.Errorf("expected %q in the logs, got %q", line, string(b))
+		}
+	}
+}
+
+func TestLogStreamClose(t *testing.T) {
+	r, w := io.Pipe()
+	logs := newLogStream()
+	logs.add("autotest-web-1", r)
+	logs.start()
+	go w.Write([]byte("one\n"))
+	buf := make([]byte, 64)
+	n, err := logs.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "autotest-web-1: one\n" {
+		t.Errorf("expected the followed line, got %q", string(buf[:n]))
+	}
+	logs.Close()
+	logs.Close()
+	if _, err := logs.Read(buf); err == nil {
+		t.Error("expected reading a closed stream to fail")
+	}
+}
+
+func TestSequentialLogs(t *testing.T) {
+	var opened []string
+	logs := newSequentialLogs([]string{"autotest-web-1", "autotest-worker-1"}, func(pod string) (io.ReadCloser, error) {
+		opened = append(opened, pod)
+		return ioutil.NopCloser(strings.NewReader(pod[9:] + "\n")), nil
+	})
+	b, err := ioutil.ReadAll(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "autotest-web-1: web-1\nautotest-worker-1: worker-1\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, string(b))
+	}
+	if len(opened) != 2 {
+		t.Errorf("expected both pods' logs to be requested, got %v", opened)
+	}
+}
+
+func TestSequentialLogsError(t *testing.T) {
+	logs := newSequentialLogs([]string{"autotest-web-1"}, func(pod string) (io.ReadCloser, error) {
+		return nil, errors.New("pod is gone")
+	})
+	if _, err := ioutil.ReadAll(logs); err == nil || err.Error() != "pod is gone" {
+		t.Errorf("expected the error to end the stream, got %v", err)
+	}
+}
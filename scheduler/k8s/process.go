@@ -0,0 +1,95 @@
+package k8s
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/fishworks/api"
+	kapi "k8s.io/client-go/1.4/pkg/api"
+	kerrors "k8s.io/client-go/1.4/pkg/api/errors"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+// Processes lists the pods of the app's deployments. The pods of one-off processes are left out.
+func (s *Scheduler) Processes(app *api.App) ([]*api.Process, error) {
+	pods, err := s.pods(app, "")
+	if err != nil {
+		return nil, err
+	}
+	var procs []*api.Process
+	for i := range pods {
+		if pods[i].Labels[oneOffLabel] == "true" {
+			continue
+		}
+		procs = append(procs, processFor(&pods[i]))
+	}
+	return procs, nil
+}
+
+// RestartProcess deletes the pod, which its deployment replaces with a new one. The pods of
+// one-off processes are not restarted, since nothing would replace them.
+func (s *Scheduler) RestartProcess(app *api.App, name string) error {
+	pods := s.client.Core().Pods(app.ID)
+	pod, err := pods.Get(name)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return &api.NotFoundError{Kind: "process", ID: name}
+		}
+		return err
+	}
+	if pod.Labels[oneOffLabel] == "true" {
+		return &api.NotFoundError{Kind: "process", ID: name}
+	}
+	err = pods.Delete(name, &kapi.DeleteOptions{})
+	if err != nil && kerrors.IsNotFound(err) {
+		return &api.NotFoundError{Kind: "process", ID: name}
+	}
+	return err
+}
+
+// processFor describes the process running in a pod.
+func processFor(pod *v1types.Pod) *api.Process {
+	proc := &api.Process{
+		Name:  pod.Name,
+		Type:  pod.Labels["type"],
+		State: processState(pod),
+	}
+	proc.Version, _ = strconv.Atoi(strings.TrimPrefix(pod.Labels["version"], "v"))
+	if pod.Status.StartTime != nil {
+		proc.Started = pod.Status.StartTime.Time
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		proc.Restarts += int(status.RestartCount)
+	}
+	return proc
+}
+
+// processState boils the status of a pod down to one of the api.Process* states.
+func processState(pod *v1types.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return api.ProcessTerminating
+	}
+	if pod.Status.Phase == v1types.PodFailed {
+		return api.ProcessCrashed
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "CrashLoopBackOff", "ErrImagePull", "ImagePullBackOff", "InvalidImageName":
+				return api.ProcessCrashed
+			}
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return api.ProcessCrashed
+		}
+	}
+	if pod.Status.Phase != v1types.PodRunning {
+		return api.ProcessStarting
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			return api.ProcessStarting
+		}
+	}
+	return api.ProcessUp
+}
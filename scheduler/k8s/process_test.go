@@ -0,0 +1,55 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fishworks/api"
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func TestProcessFor(t *testing.T) {
+	started := unversioned.NewTime(time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC))
+	deleted := unversioned.NewTime(time.Date(2016, 11, 1, 13, 0, 0, 0, time.UTC))
+	running := v1types.ContainerState{Running: &v1types.ContainerStateRunning{}}
+	tests := []struct {
+		phase    v1types.PodPhase
+		deleted  *unversioned.Time
+		state    v1types.ContainerState
+		ready    bool
+		expected string
+	}{
+		{v1types.PodPending, nil, v1types.ContainerState{Waiting: &v1types.ContainerStateWaiting{Reason: "ContainerCreating"}}, false, api.ProcessStarting},
+		{v1types.PodPending, nil, v1types.ContainerState{Waiting: &v1types.ContainerStateWaiting{Reason: "ImagePullBackOff"}}, false, api.ProcessCrashed},
+		{v1types.PodRunning, nil, running, false, api.ProcessStarting},
+		{v1types.PodRunning, nil, running, true, api.ProcessUp},
+		{v1types.PodRunning, nil, v1types.ContainerState{Waiting: &v1types.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}, false, api.ProcessCrashed},
+		{v1types.PodRunning, nil, v1types.ContainerState{Terminated: &v1types.ContainerStateTerminated{ExitCode: 1}}, false, api.ProcessCrashed},
+		{v1types.PodFailed, nil, v1types.ContainerState{}, false, api.ProcessCrashed},
+		{v1types.PodRunning, &deleted, running, true, api.ProcessTerminating},
+	}
+	for _, tt := range tests {
+		pod := &v1types.Pod{
+			ObjectMeta: v1types.ObjectMeta{
+				Name:              "autotest-web-1234",
+				DeletionTimestamp: tt.deleted,
+				Labels:            map[string]string{"app": "autotest", "type": "web", "version": "v3"},
+			},
+			Status: v1types.PodStatus{
+				Phase:     tt.phase,
+				StartTime: &started,
+				ContainerStatuses: []v1types.ContainerStatus{
+					{State: tt.state, Ready: tt.ready, RestartCount: 2},
+				},
+			},
+		}
+		proc := processFor(pod)
+		if proc.State != tt.expected {
+			t.Errorf("%s %+v: expected %s, got %s", tt.phase, tt.state, tt.expected, proc.State)
+		}
+		if proc.Name != "autotest-web-1234" || proc.Type != "web" || proc.Version != 3 || proc.Restarts != 2 || !proc.Started.Equal(started.Time) {
+			t.Errorf("unexpected process %+v", proc)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/fishworks/api"
+	kerrors "k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	// restartedAtAnnotation is set on the pod template of a deployment to restart its pods.
+	// Changing the template makes the deployment roll its pods over, like a new release does.
+	restartedAtAnnotation = "deis.io/restarted-at"
+	// restartTimeout is how long the processes of a single process type may take to restart.
+	restartTimeout = 10 * time.Minute
+	// restartPollInterval is how often a deployment is checked while it restarts.
+	restartPollInterval = 2 * time.Second
+)
+
+// Restart restarts the deployment of each process type in turn, and waits for its rollout to
+// finish before moving on to the next one. The rolling update strategy of the deployments keeps
+// every replica up until its replacement is available. Once ctx is done, Restart stops waiting,
+// though a rollout which has begun carries on in the cluster.
+func (s *Scheduler) Restart(ctx context.Context, release *api.Release, typ string, progress io.Writer) error {
+	types := []string{typ}
+	if typ == "" {
+		types = nil
+		for t := range release.Build.Procfile {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+	}
+	for _, t := range types {
+		if err := s.restart(ctx, release.App, t, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restart stamps the pod template of a process type's deployment with the current time, and
+// waits for the new pods to be available.
+func (s *Scheduler) restart(ctx context.Context, app *api.App, typ string, progress io.Writer) error {
+	deployments := s.client.Extensions().Deployments(app.ID)
+	deployment, err := deployments.Get(deploymentName(app, typ))
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return fmt.Errorf("process type %s is not deployed", typ)
+		}
+		return err
+	}
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = make(map[string]string)
+	}
+	deployment.Spec.Template.Annotations[restartedAtAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+	deployment, err = deployments.Update(deployment)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(progress, "%s: restarting %d processes\n", typ, desiredReplicas(deployment))
+
+	expired := time.After(restartTimeout)
+	updated := int32(-1)
+	for {
+		current, err := deployments.Get(deployment.Name)
+		if err != nil {
+			return err
+		}
+		if rolledOut(current, deployment.Generation) {
+			fmt.Fprintf(progress, "%s: restarted\n", typ)
+			return nil
+		}
+		if n := current.Status.UpdatedReplicas; n != updated && current.Status.ObservedGeneration >= deployment.Generation {
+			updated = n
+			fmt.Fprintf(progress, "%s: %d of %d processes restarted\n", typ, n, desiredReplicas(current))
+		}
+		select {
+		case <-expired:
+			return fmt.Errorf("process type %s did not restart within %v", typ, restartTimeout)
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for process type %s to restart: %v", typ, ctx.Err())
+		case <-time.After(restartPollInterval):
+		}
+	}
+}
+
+// rolledOut reports whether the deployment has replaced all of its pods with pods of the given
+// generation of its template, and the old pods are gone.
+func rolledOut(deployment *v1beta1.Deployment, generation int64) bool {
+	status := deployment.Status
+	n := desiredReplicas(deployment)
+	return status.ObservedGeneration >= generation &&
+		status.UpdatedReplicas == n &&
+		status.Replicas == n &&
+		status.AvailableReplicas == n
+}
+
+// desiredReplicas returns the number of pods the deployment should run.
+func desiredReplicas(deployment *v1beta1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	"testing"
+
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+)
+
+func TestRolledOut(t *testing.T) {
+	three := int32(3)
+	tests := []struct {
+		status   v1beta1.DeploymentStatus
+		expected bool
+	}{
+		// the controller has not seen the new template yet
+		{v1beta1.DeploymentStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}, false},
+		{v1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 1, AvailableReplicas: 3}, false},
+		// every pod was replaced, but an old one is still shutting down
+		{v1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 3}, false},
+		{v1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2}, false},
+		{v1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}, true},
+	}
+	for _, tt := range tests {
+		deployment := &v1beta1.Deployment{
+			Spec:   v1beta1.DeploymentSpec{Replicas: &three},
+			Status: tt.status,
+		}
+		if rolledOut(deployment, 2) != tt.expected {
+			t.Errorf("%+v: expected rolled out to be %t", tt.status, tt.expected)
+		}
+	}
+}
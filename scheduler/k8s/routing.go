@@ -0,0 +1,216 @@
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fishworks/api"
+	kapi "k8s.io/client-go/1.4/pkg/api"
+	kerrors "k8s.io/client-go/1.4/pkg/api/errors"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.4/pkg/util/intstr"
+)
+
+const (
+	// webType is the process type which receives HTTP traffic, like on Heroku and Deis v1.
+	webType = "web"
+	// defaultPort is the port web processes listen on unless the app sets PORT, like on Deis v1.
+	defaultPort = 5000
+	// servicePort is the port the web service exposes inside the cluster.
+	servicePort = 80
+)
+
+// SetDomains points the app's Ingress at the web service for every domain of the app. The
+// Ingress is named after the app, and is deleted once the app has no domains left. The web
+// service itself is managed by Deploy, so domains only start serving once a release with a web
+// process is published.
+func (s *Scheduler) SetDomains(app *api.App) error {
+	ingresses := s.client.Extensions().Ingresses(app.ID)
+	if len(app.Domains) == 0 {
+		if err := ingresses.Delete(app.ID, &kapi.DeleteOptions{}); err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	ingress, err := ingresses.Get(app.ID)
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			return err
+		}
+		_, err = ingresses.Create(ingressFor(app))
+		return err
+	}
+	ingress.Spec = ingressFor(app).Spec
+	_, err = ingresses.Update(ingress)
+	return err
+}
+
+// SetCert stores the certificate and its key as a TLS secret in the app's namespace, where the
+// app's Ingress can refer to it. The secret is named after the certificate's fingerprint as well
+// as its name, so a renewed certificate gets a secret of its own and the one the Ingress is using
+// stays untouched until SetDomains switches over.
+func (s *Scheduler) SetCert(app *api.App, cert *api.Cert) error {
+	secrets := s.client.Core().Secrets(app.ID)
+	secret := &v1types.Secret{
+		ObjectMeta: v1types.ObjectMeta{
+			Name:      certSecretName(cert),
+			Namespace: app.ID,
+			Labels: map[string]string{
+				"heritage": "deis",
+				"app":      app.ID,
+			},
+		},
+		Type: v1types.SecretTypeTLS,
+		Data: map[string][]byte{
+			v1types.TLSCertKey:       []byte(cert.Certificate),
+			v1types.TLSPrivateKeyKey: []byte(cert.Key),
+		},
+	}
+	existing, err := secrets.Get(secret.Name)
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			return err
+		}
+		_, err = secrets.Create(secret)
+		return err
+	}
+	existing.Type = secret.Type
+	existing.Data = secret.Data
+	_, err = secrets.Update(existing)
+	return err
+}
+
+// RemoveCert deletes the certificate's TLS secret.
+func (s *Scheduler) RemoveCert(app *api.App, cert *api.Cert) error {
+	if err := s.client.Core().Secrets(app.ID).Delete(certSecretName(cert), &kapi.DeleteOptions{}); err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// certSecretName returns the name of the secret holding a certificate: "tls-", its name and the
+// start of its fingerprint.
+func certSecretName(cert *api.Cert) string {
+	return fmt.Sprintf("tls-%s-%s", cert.Name, strings.ToLower(cert.Fingerprint[:8]))
+}
+
+// syncService creates or updates the service routing to the release's web processes, or deletes
+// it when the release has no web process.
+func (s *Scheduler) syncService(release *api.Release) error {
+	app := release.App
+	services := s.client.Core().Services(app.ID)
+	if _, ok := release.Build.Procfile[webType]; !ok {
+		if err := services.Delete(serviceName(app), &kapi.DeleteOptions{}); err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	port, err := webPort(release)
+	if err != nil {
+		return err
+	}
+	service, err := services.Get(serviceName(app))
+	if err != nil {
+		if !kerrors.IsNotFound(err) {
+			return err
+		}
+		_, err = services.Create(serviceFor(app, port))
+		return err
+	}
+	// update the existing service in place so it keeps its cluster IP
+	desired := serviceFor(app, port)
+	service.Spec.Selector = desired.Spec.Selector
+	service.Spec.Ports = desired.Spec.Ports
+	_, err = services.Update(service)
+	return err
+}
+
+// webPort returns the port the release's web processes listen on: the PORT config value if the
+// app sets it, otherwise defaultPort.
+func webPort(release *api.Release) (int, error) {
+	value, ok := release.Config.Get("PORT")
+	if !ok {
+		return defaultPort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("PORT must be a port number between 1 and 65535, got %q", value)
+	}
+	return port, nil
+}
+
+// serviceName returns the name of the service routing to the app's web processes.
+func serviceName(app *api.App) string {
+	return deploymentName(app, webType)
+}
+
+// serviceFor builds the service which load balances across the app's web processes, sending
+// traffic to the given container port.
+func serviceFor(app *api.App, port int) *v1types.Service {
+	return &v1types.Service{
+		ObjectMeta: v1types.ObjectMeta{
+			Name:      serviceName(app),
+			Namespace: app.ID,
+			Labels: map[string]string{
+				"heritage": "deis",
+				"app":      app.ID,
+				"type":     webType,
+			},
+		},
+		Spec: v1types.ServiceSpec{
+			Selector: map[string]string{
+				"app":  app.ID,
+				"type": webType,
+			},
+			Ports: []v1types.ServicePort{
+				v1types.ServicePort{
+					Name:       "http",
+					Protocol:   v1types.ProtocolTCP,
+					Port:       servicePort,
+					TargetPort: intstr.FromInt(port),
+				},
+			},
+		},
+	}
+}
+
+// ingressFor builds the Ingress which routes every domain of the app to its web service. Domains
+// covered by one of the app's certificates are served over HTTPS with that certificate.
+func ingressFor(app *api.App) *v1beta1.Ingress {
+	backend := v1beta1.IngressBackend{
+		ServiceName: serviceName(app),
+		ServicePort: intstr.FromInt(servicePort),
+	}
+	var rules []v1beta1.IngressRule
+	for _, domain := range app.Domains {
+		rules = append(rules, v1beta1.IngressRule{
+			Host: domain,
+			IngressRuleValue: v1beta1.IngressRuleValue{
+				HTTP: &v1beta1.HTTPIngressRuleValue{
+					Paths: []v1beta1.HTTPIngressPath{
+						v1beta1.HTTPIngressPath{Path: "/", Backend: backend},
+					},
+				},
+			},
+		})
+	}
+	var tls []v1beta1.IngressTLS
+	for _, cert := range app.Certs {
+		if hosts := app.CertDomains(cert); len(hosts) > 0 {
+			tls = append(tls, v1beta1.IngressTLS{Hosts: hosts, SecretName: certSecretName(cert)})
+		}
+	}
+	return &v1beta1.Ingress{
+		ObjectMeta: v1types.ObjectMeta{
+			Name:      app.ID,
+			Namespace: app.ID,
+			Labels: map[string]string{
+				"heritage": "deis",
+				"app":      app.ID,
+			},
+		},
+		Spec: v1beta1.IngressSpec{TLS: tls, Rules: rules},
+	}
+}
@@ -0,0 +1,31 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/fishworks/api"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func TestWebPort(t *testing.T) {
+	tests := []struct {
+		config *api.Config
+		port   int
+		valid  bool
+	}{
+		{nil, defaultPort, true},
+		{&api.Config{}, defaultPort, true},
+		{&api.Config{Values: []v1types.EnvVar{{Name: "PORT", Value: "8080"}}}, 8080, true},
+		{&api.Config{Values: []v1types.EnvVar{{Name: "PORT", Value: "http"}}}, 0, false},
+		{&api.Config{Values: []v1types.EnvVar{{Name: "PORT", Value: "70000"}}}, 0, false},
+	}
+	for _, tt := range tests {
+		port, err := webPort(&api.Release{Config: tt.config})
+		if (err == nil) != tt.valid {
+			t.Errorf("%v: expected valid=%t, got %v", tt.config, tt.valid, err)
+		}
+		if port != tt.port {
+			t.Errorf("%v: expected port %d, got %d", tt.config, tt.port, port)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	kapi "k8s.io/client-go/1.4/pkg/api"
+	kerrors "k8s.io/client-go/1.4/pkg/api/errors"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+const (
+	// oneOffLabel marks the pods of one-off processes. They have no type label, so that they are
+	// kept apart from the pods of the app's deployments, even those of a process type named "run".
+	oneOffLabel = "oneoff"
+	// runName is the name of the container of a one-off process, and prefixes the name of its pod.
+	runName = "run"
+	// runStartTimeout is how long a one-off process may take to start, which includes pulling
+	// its image.
+	runStartTimeout = 5 * time.Minute
+	// runPollInterval is how often the pod of a one-off process is checked while waiting for it
+	// to start or to exit.
+	runPollInterval = time.Second
+)
+
+// Run starts a pod which runs command in a shell with the release's image and config, and waits
+// for it to start. The pod never restarts; it is deleted when the returned OneOff is closed.
+func (s *Scheduler) Run(release *api.Release, command string) (api.OneOff, error) {
+	pods := s.client.Core().Pods(release.App.ID)
+	pod, err := pods.Create(runPodFor(release, command))
+	if err != nil {
+		return nil, err
+	}
+	proc := &oneOff{s: s, app: release.App, name: pod.Name}
+	if err := proc.waitForStart(); err != nil {
+		proc.Close()
+		return nil, err
+	}
+	stream, err := pods.GetLogs(pod.Name, &v1types.PodLogOptions{Follow: true}).Stream()
+	if err != nil {
+		proc.Close()
+		return nil, err
+	}
+	proc.stream = stream
+	return proc, nil
+}
+
+// oneOff is a one-off process running in a pod of its own.
+type oneOff struct {
+	s      *Scheduler
+	app    *api.App
+	name   string
+	stream io.ReadCloser
+	once   sync.Once
+}
+
+func (p *oneOff) Read(b []byte) (int, error) {
+	return p.stream.Read(b)
+}
+
+// ExitCode waits for the pod to terminate and returns the exit code of its container.
+func (p *oneOff) ExitCode() (int, error) {
+	for {
+		pod, err := p.s.client.Core().Pods(p.app.ID).Get(p.name)
+		if err != nil {
+			return 0, err
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil {
+				return int(status.State.Terminated.ExitCode), nil
+			}
+		}
+		time.Sleep(runPollInterval)
+	}
+}
+
+// Close stops reading the output and deletes the pod, which kills the process if it is still
+// running. It is safe to call more than once.
+func (p *oneOff) Close() error {
+	var err error
+	p.once.Do(func() {
+		if p.stream != nil {
+			p.stream.Close()
+		}
+		err = p.s.client.Core().Pods(p.app.ID).Delete(p.name, &kapi.DeleteOptions{})
+		if err != nil && kerrors.IsNotFound(err) {
+			err = nil
+		}
+		if err != nil {
+			log.Errorf("could not delete one-off pod %s of %s: %v", p.name, p.app, err)
+		}
+	})
+	return err
+}
+
+// waitForStart waits until the pod's container has started, or has already run to completion.
+// It fails early if the image cannot be pulled.
+func (p *oneOff) waitForStart() error {
+	expired := time.After(runStartTimeout)
+	for {
+		pod, err := p.s.client.Core().Pods(p.app.ID).Get(p.name)
+		if err != nil {
+			return err
+		}
+		if pod.Status.Phase != v1types.PodPending {
+			return nil
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if waiting := status.State.Waiting; waiting != nil {
+				switch waiting.Reason {
+				case "ErrImagePull", "ImagePullBackOff", "InvalidImageName":
+					return fmt.Errorf("could not pull %s: %s", pod.Spec.Containers[0].Image, waiting.Message)
+				}
+			}
+		}
+		select {
+		case <-expired:
+			return fmt.Errorf("one-off process did not start within %v", runStartTimeout)
+		case <-time.After(runPollInterval):
+		}
+	}
+}
+
+// runPodFor builds the pod which runs a one-off command with the release's build and config.
+func runPodFor(release *api.Release, command string) *v1types.Pod {
+	var env []v1types.EnvVar
+	if release.Config != nil {
+		env = append(env, release.Config.Values...)
+	}
+	return &v1types.Pod{
+		ObjectMeta: v1types.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-%s-", release.App.ID, runName),
+			Namespace:    release.App.ID,
+			Labels: map[string]string{
+				"heritage":  "deis",
+				"app":       release.App.ID,
+				oneOffLabel: "true",
+				"version":   fmt.Sprintf("v%d", release.Version),
+			},
+		},
+		Spec: v1types.PodSpec{
+			RestartPolicy: v1types.RestartPolicyNever,
+			Containers: []v1types.Container{
+				v1types.Container{
+					Name:            runName,
+					Image:           release.Build.Image,
+					ImagePullPolicy: v1types.PullAlways,
+					Command:         []string{"/bin/sh", "-c", command},
+					Env:             env,
+					Resources:       resourcesFor(release.Limits[api.OneOffType]),
+				},
+			},
+		},
+	}
+}
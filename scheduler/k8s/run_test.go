@@ -0,0 +1,37 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fishworks/api"
+	v1types "k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func TestRunPodFor(t *testing.T) {
+	app := &api.App{ID: "autotest"}
+	release := &api.Release{
+		App:     app,
+		Version: 4,
+		Build: &api.Build{
+			Image:    "deis/example-go:latest",
+			Procfile: map[string][]string{"run": {"./run"}},
+		},
+		Limits: api.Limits{api.OneOffType: {MemoryLimit: "512Mi"}},
+	}
+	pod := runPodFor(release, "rake db:migrate")
+	// the pods of a process type named "run" are selected by type, and must not include this one
+	if _, ok := pod.Labels["type"]; ok {
+		t.Errorf("expected the pod to have no type label, got %v", pod.Labels)
+	}
+	if pod.Labels[oneOffLabel] != "true" || pod.Labels["app"] != "autotest" || pod.Labels["version"] != "v4" {
+		t.Errorf("expected the pod to be labelled as a one-off of autotest v4, got %v", pod.Labels)
+	}
+	container := pod.Spec.Containers[0]
+	if !reflect.DeepEqual(container.Command, []string{"/bin/sh", "-c", "rake db:migrate"}) {
+		t.Errorf("expected the command to run in a shell, got %v", container.Command)
+	}
+	if memory := container.Resources.Limits[v1types.ResourceMemory]; memory.String() != "512Mi" {
+		t.Errorf("expected a memory limit of 512Mi, got %v", container.Resources.Limits)
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/store"
+	"github.com/julienschmidt/httprouter"
+)
+
+type contextKey int
+
+const userKey contextKey = 0
+
+// credentials is the request body of the register and login endpoints.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// authMiddleware rejects requests which do not carry a valid "Authorization: token <token>"
+// header. The authenticated user is attached to the request and can be retrieved with
+// currentUser.
+func authMiddleware(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		fields := strings.Fields(r.Header.Get("Authorization"))
+		if len(fields) != 2 || strings.ToLower(fields[0]) != "token" {
+			writeError(w, r, &api.UnauthorizedError{Message: "expected an Authorization: token <token> header"})
+			return
+		}
+		user, err := Store.GetUserByToken(fields[1])
+		if err != nil {
+			if err == store.ErrUserNotFound {
+				writeError(w, r, &api.UnauthorizedError{Message: "invalid token"})
+			} else {
+				writeError(w, r, fmt.Errorf("could not authenticate: %v", err))
+			}
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), userKey, user)), p)
+	}
+}
+
+// currentUser returns the user who made the request. It is only set on routes behind
+// authMiddleware.
+func currentUser(r *http.Request) *api.User {
+	user, _ := r.Context().Value(userKey).(*api.User)
+	return user
+}
+
+// decodeCredentials reads a username and password from the request body. If it cannot, the
+// appropriate error has already been written to the response and nil is returned.
+func decodeCredentials(w http.ResponseWriter, r *http.Request) *credentials {
+	var creds credentials
+	if r.Body == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "a username and password are required"})
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeError(w, r, decodeError(err))
+		return nil
+	}
+	return &creds
+}
+
+// register creates a new, non-admin user account.
+func register(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	creds := decodeCredentials(w, r)
+	if creds == nil {
+		return
+	}
+	user, err := api.NewUser(creds.Username, creds.Password, false)
+	if err != nil {
+		if _, ok := err.(*api.UserError); !ok {
+			err = fmt.Errorf("could not register user: %v", err)
+		}
+		writeError(w, r, err)
+		return
+	}
+	if err := Store.CreateUser(user); err != nil {
+		if err == store.ErrUserExists {
+			err = &api.ConflictError{Kind: "user", Message: fmt.Sprintf("user %s already exists", user)}
+		} else {
+			err = fmt.Errorf("could not register user: %v", err)
+		}
+		writeError(w, r, err)
+		return
+	}
+	if err := WriteJSON(w, user, http.StatusCreated); err != nil {
+		log.Error(err)
+	}
+}
+
+// unknownUser stands in for users who do not exist when logging in. Checking a password against
+// its hash, which no password matches, takes as long as checking a real user's password does.
+var unknownUser = &api.User{PasswordHash: []byte("$2a$10$XODWYRF45vPz3w1vGg2IkOVSbkcKgalC85VWFKCC6H5MPZxVlID0u")}
+
+// login exchanges a username and password for the user's API token.
+func login(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	creds := decodeCredentials(w, r)
+	if creds == nil {
+		return
+	}
+	user, err := Store.GetUser(creds.Username)
+	if err != nil && err != store.ErrUserNotFound {
+		writeError(w, r, fmt.Errorf("could not log in: %v", err))
+		return
+	}
+	// don't tell apart unknown users from wrong passwords, not even by how long it takes
+	if user == nil {
+		unknownUser.CheckPassword(creds.Password)
+		writeError(w, r, &api.UnauthorizedError{Message: "invalid username or password"})
+		return
+	}
+	if !user.CheckPassword(creds.Password) {
+		writeError(w, r, &api.UnauthorizedError{Message: "invalid username or password"})
+		return
+	}
+	if err := WriteJSON(w, map[string]string{"token": user.Token}, http.StatusOK); err != nil {
+		log.Error(err)
+	}
+}
+
+// whoami responds with the authenticated user.
+func whoami(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if err := WriteJSON(w, currentUser(r), http.StatusOK); err != nil {
+		log.Error(err)
+	}
+}
+
+// generatedPasswordOutput is where BootstrapAdmin writes the password it generates. It is kept
+// out of the logs, which are often shipped elsewhere and kept for a long time.
+var generatedPasswordOutput io.Writer = os.Stderr
+
+// BootstrapAdmin creates an admin user when the store has no users yet, so that a fresh install
+// can be logged into. If password is empty, a random one is generated and written once to
+// stderr. It does nothing once any user exists.
+func BootstrapAdmin(username, password string) error {
+	users, err := Store.Users()
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return nil
+	}
+	generated := password == ""
+	if generated {
+		if password, err = api.GenerateToken(); err != nil {
+			return err
+		}
+	}
+	user, err := api.NewUser(username, password, true)
+	if err != nil {
+		return err
+	}
+	if err := Store.CreateUser(user); err != nil {
+		return err
+	}
+	if generated {
+		fmt.Fprintf(generatedPasswordOutput, "generated password for admin user %s: %s\n", username, password)
+		log.Warnf("created admin user %s with a generated password, which was written to stderr", username)
+	} else {
+		log.Infof("created admin user %s", username)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getAppCertsJSON lists the certificates attached to the app. Their keys are never returned.
+func getAppCertsJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if len(app.Certs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		if err := WriteJSON(w, app.Certs, http.StatusOK); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// addCert uploads a PEM encoded certificate and key for some of the app's domains, and serves
+// those domains over HTTPS with it. Uploading a certificate with the name of an existing one
+// replaces it, which is how certificates are renewed.
+func addCert(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var form struct {
+		Name        string `json:"name"`
+		Certificate string `json:"certificate"`
+		Key         string `json:"key"`
+	}
+	if r.Body == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "a certificate and key are required"})
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		writeError(w, r, decodeError(err))
+		return
+	}
+	cert, err := api.NewCert(form.Name, form.Certificate, form.Key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if len(app.CertDomains(cert)) == 0 {
+		writeError(w, r, &api.CertError{Message: fmt.Sprintf("it is valid for %v, which are not domains of %s", cert.Domains, app)})
+		return
+	}
+	var previous *api.Cert
+	for _, c := range app.Certs {
+		if c.Name == cert.Name {
+			previous = c
+		}
+	}
+	app.SetCert(cert)
+	if err := Scheduler.SetCert(app, cert); err != nil {
+		writeError(w, r, &api.SchedulerError{Message: "could not store certificate: " + err.Error()})
+		return
+	}
+	// the scheduler stores a certificate with a new fingerprint next to the one it replaces, which
+	// keeps serving until the domains are switched over
+	replaced := previous != nil && previous.Fingerprint != cert.Fingerprint
+	if !setDomains(w, r, app) {
+		if previous == nil || replaced {
+			if err := Scheduler.RemoveCert(app, cert); err != nil {
+				log.Errorf("could not undo storing certificate %s of %s: %v", cert.Name, app, err)
+			}
+		}
+		return
+	}
+	if replaced {
+		if err := Scheduler.RemoveCert(app, previous); err != nil {
+			log.Errorf("could not delete the replaced certificate %s of %s: %v", previous.Name, app, err)
+		}
+	}
+	if err := WriteJSON(w, cert, http.StatusCreated); err != nil {
+		log.Error(err)
+	}
+}
+
+// removeCert stops serving the app's domains with a certificate and deletes it.
+func removeCert(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	cert, err := app.RemoveCert(p.ByName("name"))
+	if err != nil {
+		writeError(w, r, &api.NotFoundError{Kind: "certificate", ID: p.ByName("name")})
+		return
+	}
+	// stop using the certificate before deleting it
+	if !setDomains(w, r, app) {
+		return
+	}
+	if err := Scheduler.RemoveCert(app, cert); err != nil {
+		log.Errorf("could not delete certificate %s of %s: %v", cert.Name, app, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getAppDomainsJSON lists the domains attached to the app.
+func getAppDomainsJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if len(app.Domains) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		if err := WriteJSON(w, app.Domains, http.StatusOK); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// addDomain attaches a domain to the app, unless another app already uses it, and routes it to
+// the app's web processes.
+func addDomain(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var form struct {
+		Domain string `json:"domain"`
+	}
+	if r.Body == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "a domain is required"})
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		writeError(w, r, decodeError(err))
+		return
+	}
+	domain := strings.ToLower(form.Domain)
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	domainsLock.Lock()
+	defer domainsLock.Unlock()
+	apps, err := Store.Apps()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("could not list applications: %v", err))
+		return
+	}
+	for _, other := range apps {
+		if other.ID != app.ID && other.HasDomain(domain) {
+			writeError(w, r, &api.ConflictError{Kind: "domain", Message: fmt.Sprintf("could not add domain: %s is already used by another app", domain)})
+			return
+		}
+	}
+	if err := app.AddDomain(domain); err != nil {
+		if err == api.ErrDomainExists {
+			err = &api.ConflictError{Kind: "domain", Message: fmt.Sprintf("could not add domain: %s is already attached to %s", domain, app)}
+		}
+		writeError(w, r, err)
+		return
+	}
+	if !setDomains(w, r, app) {
+		return
+	}
+	if err := WriteJSON(w, app.Domains, http.StatusCreated); err != nil {
+		log.Error(err)
+	}
+}
+
+// removeDomain detaches a domain from the app and stops routing it.
+func removeDomain(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	domain := strings.ToLower(p.ByName("domain"))
+	if err := app.RemoveDomain(domain); err != nil {
+		writeError(w, r, &api.NotFoundError{Kind: "domain", ID: domain})
+		return
+	}
+	if !setDomains(w, r, app) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setDomains applies the app's domains on the scheduler and saves them. If it cannot, the
+// appropriate error has already been written to the response and false is returned.
+func setDomains(w http.ResponseWriter, r *http.Request, app *api.App) bool {
+	if err := Scheduler.SetDomains(app); err != nil {
+		writeError(w, r, &api.SchedulerError{Message: "could not route domains: " + err.Error()})
+		return false
+	}
+	if err := Store.UpdateApp(app); err != nil {
+		writeError(w, r, fmt.Errorf("could not save app: %v", err))
+		return false
+	}
+	return true
+}
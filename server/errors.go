@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/store"
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	// errShuttingDown is returned for requests which arrive once the server is shutting down.
+	errShuttingDown = errors.New("the server is shutting down")
+	// errMethodNotAllowed is returned for requests to a known path with the wrong method.
+	errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	// Code identifies the error, such as app_not_found. Unlike the message, it never changes.
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorStatus maps an error to the HTTP status code and error code it is reported with. Errors
+// which are not listed are reported as internal errors.
+func errorStatus(err error) (int, string) {
+	switch err := err.(type) {
+	case *api.NotFoundError:
+		return http.StatusNotFound, errorCode(err.Kind) + "_not_found"
+	case *api.ConflictError:
+		return http.StatusConflict, errorCode(err.Kind) + "_exists"
+	case *api.InvalidRequestError:
+		return http.StatusBadRequest, "invalid_request"
+	case *api.UnauthorizedError:
+		return http.StatusUnauthorized, "unauthorized"
+	case *api.ForbiddenError:
+		return http.StatusForbidden, "forbidden"
+	case *api.SchedulerError:
+		return http.StatusServiceUnavailable, "scheduler_error"
+	case *api.TimeoutError:
+		return http.StatusGatewayTimeout, "timeout"
+	case *api.UserError:
+		return http.StatusBadRequest, "invalid_user"
+	case *api.AppError:
+		return http.StatusBadRequest, "invalid_app"
+	case *api.BuildError:
+		return http.StatusBadRequest, "invalid_build"
+	case *api.DomainError:
+		return http.StatusBadRequest, "invalid_domain"
+	case *api.CertError:
+		return http.StatusBadRequest, "invalid_certificate"
+	case *api.ScaleError:
+		return http.StatusBadRequest, "invalid_scale"
+	case *api.LimitsError:
+		return http.StatusBadRequest, "invalid_limits"
+	case *api.ReleaseError:
+		return http.StatusBadRequest, "invalid_release"
+	case *api.VersionError:
+		return http.StatusBadRequest, "incompatible_api_version"
+	}
+	switch err {
+	case api.ErrInvalidVersion:
+		return http.StatusBadRequest, "invalid_version"
+	case api.ErrReleaseNotFound:
+		return http.StatusNotFound, "release_not_found"
+	case api.ErrCollaboratorExists:
+		return http.StatusConflict, "collaborator_exists"
+	case api.ErrCollaboratorNotFound:
+		return http.StatusNotFound, "collaborator_not_found"
+	case api.ErrDomainExists:
+		return http.StatusConflict, "domain_exists"
+	case api.ErrDomainNotFound:
+		return http.StatusNotFound, "domain_not_found"
+	case api.ErrCertNotFound:
+		return http.StatusNotFound, "certificate_not_found"
+	case store.ErrAppNotFound:
+		return http.StatusNotFound, "app_not_found"
+	case store.ErrAppExists:
+		return http.StatusConflict, "app_exists"
+	case store.ErrUserNotFound:
+		return http.StatusNotFound, "user_not_found"
+	case store.ErrUserExists:
+		return http.StatusConflict, "user_exists"
+	case store.ErrVersionConflict:
+		return http.StatusConflict, "version_conflict"
+	case errShuttingDown:
+		return http.StatusServiceUnavailable, "shutting_down"
+	case errMethodNotAllowed:
+		return http.StatusMethodNotAllowed, "method_not_allowed"
+	}
+	return http.StatusInternalServerError, "internal_error"
+}
+
+// errorCode turns a kind of resource, such as "config value", into an error code prefix.
+func errorCode(kind string) string {
+	return strings.Replace(kind, " ", "_", -1)
+}
+
+// writeError responds with the error envelope for err. Internal errors are logged as well, since
+// they usually point at a problem with the store.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+	if _, ok := err.(*api.UnauthorizedError); ok {
+		w.Header().Set("WWW-Authenticate", "Token")
+	}
+	body := errorResponse{
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: requestID(r),
+	}
+	if err := WriteJSON(w, body, status); err != nil {
+		log.Error(err)
+	}
+}
+
+// notFound responds to requests for unknown routes.
+func notFound(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writeError(w, r, &api.NotFoundError{Kind: "route", ID: r.URL.Path})
+}
+
+// methodNotAllowed responds to requests for known routes with an unsupported method.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writeError(w, r, errMethodNotAllowed)
+}
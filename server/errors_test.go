@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+func TestErrorCodes(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	Store.CreateUser(&api.User{Username: "stranger", Token: "stranger-token"})
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		body   string
+		code   int
+		error  string
+	}{
+		{"", "GET", "/apps", ``, http.StatusUnauthorized, "unauthorized"},
+		{"bogus", "GET", "/apps", ``, http.StatusUnauthorized, "unauthorized"},
+		{"", "POST", "/auth/login", `{"username":"autotest","password":"wrong"}`, http.StatusUnauthorized, "unauthorized"},
+		{"", "POST", "/auth/register", `{"username":"no spaces","password":"secret"}`, http.StatusBadRequest, "invalid_user"},
+		{"", "POST", "/auth/register", `{"username":"autotest","password":"secret"}`, http.StatusConflict, "user_exists"},
+		{testToken, "GET", "/nowhere", ``, http.StatusNotFound, "route_not_found"},
+		{testToken, "PUT", "/apps", ``, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{testToken, "GET", "/apps/missing", ``, http.StatusNotFound, "app_not_found"},
+		{testToken, "POST", "/apps", `{"id":"autotest"}`, http.StatusCreated, ""},
+		{testToken, "POST", "/apps", `{"id":"autotest"}`, http.StatusConflict, "app_exists"},
+		{testToken, "POST", "/apps", `{"id":"Auto_Test"}`, http.StatusBadRequest, "invalid_app"},
+		{testToken, "POST", "/apps", `{"id":"kube-system"}`, http.StatusBadRequest, "invalid_app"},
+		{"stranger-token", "GET", "/apps/autotest", ``, http.StatusForbidden, "forbidden"},
+		{testToken, "POST", "/apps/autotest/config", `{`, http.StatusBadRequest, "invalid_request"},
+		{testToken, "POST", "/apps/autotest/config", `{"values":[{"value":"bar"}]}`, http.StatusBadRequest, "invalid_request"},
+		{testToken, "DELETE", "/apps/autotest/config/FOO", ``, http.StatusNotFound, "config_value_not_found"},
+		{testToken, "GET", "/apps/autotest/releases/v9", ``, http.StatusNotFound, "release_not_found"},
+		{testToken, "POST", "/apps/autotest/releases/rollback", `{"version":9}`, http.StatusNotFound, "release_not_found"},
+		{testToken, "POST", "/apps/autotest/releases/rollback", `{"version":1}`, http.StatusBadRequest, "invalid_release"},
+		{testToken, "POST", "/apps/autotest/builds", `{"image":"deis/example-go:latest","procfile":{"web.1":["./web"]}}`, http.StatusBadRequest, "invalid_build"},
+		{testToken, "POST", "/apps/autotest/builds", ``, http.StatusBadRequest, "invalid_request"},
+		{testToken, "POST", "/apps/autotest/builds", `null`, http.StatusBadRequest, "invalid_request"},
+		{testToken, "POST", "/apps/autotest/scale", `{"web":1}`, http.StatusBadRequest, "invalid_scale"},
+		{testToken, "POST", "/apps/autotest/perms", `{"username":"nobody"}`, http.StatusNotFound, "user_not_found"},
+		{testToken, "DELETE", "/apps/autotest/perms/nobody", ``, http.StatusNotFound, "collaborator_not_found"},
+		{testToken, "POST", "/apps/autotest/domains", `{"domain":"localhost"}`, http.StatusBadRequest, "invalid_domain"},
+		{testToken, "POST", "/apps/autotest/domains", `{"domain":"www.example.com"}`, http.StatusCreated, ""},
+		{testToken, "POST", "/apps/autotest/domains", `{"domain":"www.example.com"}`, http.StatusConflict, "domain_exists"},
+		{testToken, "DELETE", "/apps/autotest/domains/api.example.com", ``, http.StatusNotFound, "domain_not_found"},
+		{testToken, "POST", "/apps/autotest/certs", `{"certificate":"junk","key":"junk"}`, http.StatusBadRequest, "invalid_certificate"},
+		{testToken, "DELETE", "/apps/autotest/certs/www-example-com", ``, http.StatusNotFound, "certificate_not_found"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRecorder()
+		req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.token != "" {
+			req.Header.Set("Authorization", "token "+tt.token)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("%s %s: %d expected, received %d: %s", tt.method, tt.path, tt.code, r.Code, r.Body.String())
+			continue
+		}
+		if tt.error == "" {
+			continue
+		}
+		var body errorResponse
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("%s %s: expected a JSON error, got %v", tt.method, tt.path, err)
+			continue
+		}
+		if body.Code != tt.error || body.Message == "" {
+			t.Errorf("%s %s: expected error code %s with a message, got %+v", tt.method, tt.path, tt.error, body)
+		}
+	}
+}
+
+func TestSchedulerErrors(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	Scheduler.(*fake.Scheduler).Err = errors.New("the cluster is on fire")
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	r := httptest.NewRecorder()
+	req, err := newRequest("DELETE", "/apps/autotest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-ID", "abc123")
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusServiceUnavailable {
+		t.Fatalf("%d Service Unavailable expected, received %d", http.StatusServiceUnavailable, r.Code)
+	}
+	if ct := r.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON error, got %s", ct)
+	}
+	var body errorResponse
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != "scheduler_error" || body.RequestID != "abc123" {
+		t.Errorf("expected a scheduler_error for request abc123, got %+v", body)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+)
+
+// execIdleTimeout is how long an exec session may go without input or output before it is
+// closed, so that forgotten sessions do not pile up in the cluster.
+var execIdleTimeout = 10 * time.Minute
+
+// execWriteTimeout is how long sending a message to the client of an exec session may take.
+const execWriteTimeout = 10 * time.Second
+
+// defaultExecCommand is the command run by an exec session when the client does not name one.
+var defaultExecCommand = []string{"/bin/sh"}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// execMessage is a control message sent by the client of an exec session as a text message.
+// Input for the terminal is sent as binary messages instead.
+type execMessage struct {
+	// Type is the kind of message. Only "resize" is supported.
+	Type   string `json:"type"`
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+// execProcess opens a terminal in one of the app's processes and proxies it over a WebSocket,
+// for debugging. The command is given by the command query parameter, once per argument, and
+// defaults to a shell. The terminal's output is sent as binary messages, and the connection is
+// closed once the command exits or the session has been idle for execIdleTimeout.
+func execProcess(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeError(w, r, &api.InvalidRequestError{Message: "exec sessions must be opened over a WebSocket"})
+		return
+	}
+	command := r.URL.Query()["command"]
+	if len(command) == 0 {
+		command = defaultExecCommand
+	}
+	name := p.ByName("name")
+	term, err := Scheduler.Exec(app, name, command)
+	if err != nil {
+		if _, ok := err.(*api.NotFoundError); !ok {
+			err = &api.SchedulerError{Message: "could not start exec session: " + err.Error()}
+		}
+		writeError(w, r, err)
+		return
+	}
+	defer term.Close()
+	// the upgrader responds to the client itself if the handshake fails
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	log.Infof("%s is executing %q in %s of %s", currentUser(r), command, name, app)
+
+	s := &execSession{
+		conn:     conn,
+		term:     term,
+		timeout:  execIdleTimeout,
+		activity: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.watch(r)
+	}()
+	go func() {
+		defer wg.Done()
+		s.copyOutput()
+	}()
+	s.copyInput()
+	wg.Wait()
+}
+
+// execSession proxies a terminal over a WebSocket.
+type execSession struct {
+	conn     *websocket.Conn
+	term     api.Terminal
+	timeout  time.Duration
+	activity chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// copyInput sends the client's input and resizes to the terminal until the connection closes.
+func (s *execSession) copyInput() {
+	for {
+		typ, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.close(websocket.CloseNormalClosure, "")
+			return
+		}
+		s.touch()
+		switch typ {
+		case websocket.BinaryMessage:
+			if _, err := s.term.Write(data); err != nil {
+				s.close(websocket.CloseInternalServerErr, "could not write to the terminal")
+				return
+			}
+		case websocket.TextMessage:
+			var msg execMessage
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "resize" {
+				s.close(websocket.CloseUnsupportedData, "unknown control message")
+				return
+			}
+			if err := s.term.Resize(msg.Width, msg.Height); err != nil {
+				log.Errorf("could not resize terminal: %v", err)
+			}
+		}
+	}
+}
+
+// copyOutput sends the terminal's output to the client until the command exits.
+func (s *execSession) copyOutput() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.term.Read(buf)
+		if n > 0 {
+			s.touch()
+			s.conn.SetWriteDeadline(time.Now().Add(execWriteTimeout))
+			if err := s.conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+				s.close(websocket.CloseNormalClosure, "")
+				return
+			}
+		}
+		if err != nil {
+			s.close(websocket.CloseNormalClosure, "process exited")
+			return
+		}
+	}
+}
+
+// watch closes the session once it has been idle for its timeout, or when the server shuts
+// down.
+func (s *execSession) watch(r *http.Request) {
+	idle := time.NewTimer(s.timeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-s.activity:
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(s.timeout)
+		case <-idle.C:
+			s.close(websocket.CloseGoingAway, "idle timeout")
+			return
+		case <-r.Context().Done():
+			s.close(websocket.CloseGoingAway, "server is shutting down")
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// touch resets the idle timer of the session.
+func (s *execSession) touch() {
+	select {
+	case s.activity <- struct{}{}:
+	default:
+	}
+}
+
+// close closes the terminal and tells the client why the session ended, the first time it is
+// called, then closes the connection, which ends the other goroutines of the session.
+func (s *execSession) close(code int, reason string) {
+	s.once.Do(func() {
+		close(s.done)
+		// the terminal is closed first, so that it is gone by the time the client hears of it
+		s.term.Close()
+		s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(execWriteTimeout))
+		s.conn.Close()
+	})
+}
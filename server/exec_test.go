@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+	"github.com/gorilla/websocket"
+)
+
+// dialExec opens an exec session with the process of the autotest app, authenticated with
+// token.
+func dialExec(srv *HTTPServer, process, token string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set("Authorization", "token "+token)
+	url := "ws://" + srv.l.Addr().String() + "/apps/autotest/processes/" + process + "/exec?command=/bin/bash&command=-l"
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+func TestExecProcess(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	scheduler := Scheduler.(*fake.Scheduler)
+	scheduler.ProcessList = map[string][]*api.Process{"autotest": {{Name: "autotest-web-1234", Type: "web"}}}
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+
+	conn, _, err := dialExec(srv, "autotest-web-1234", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","width":120,"height":40}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ls\n")); err != nil {
+		t.Fatal(err)
+	}
+	typ, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.BinaryMessage || string(data) != "ls\n" {
+		t.Errorf("expected the output of the terminal, got %d %q", typ, data)
+	}
+	// the fake terminal's command exits on "exit\n", which closes the session
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("exit\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected a normal closure once the command exited, got %v", err)
+	}
+
+	calls := scheduler.CallsTo("Exec")
+	if len(calls) != 1 || calls[0].Process != "autotest-web-1234" || calls[0].Command != "/bin/bash -l" {
+		t.Errorf("expected /bin/bash -l to run in autotest-web-1234, got %+v", calls)
+	}
+	term := scheduler.Terminals()[0]
+	if sizes := term.Sizes(); !reflect.DeepEqual(sizes, [][2]uint16{{120, 40}}) {
+		t.Errorf("expected the terminal to be resized to 120x40, got %v", sizes)
+	}
+	if !term.Closed() {
+		t.Error("expected the terminal to be closed")
+	}
+}
+
+func TestExecIdleTimeout(t *testing.T) {
+	defer clearDB()
+	defer func(timeout time.Duration) { execIdleTimeout = timeout }(execIdleTimeout)
+	execIdleTimeout = 50 * time.Millisecond
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	scheduler := Scheduler.(*fake.Scheduler)
+	scheduler.ProcessList = map[string][]*api.Process{"autotest": {{Name: "autotest-web-1234", Type: "web"}}}
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+
+	conn, _, err := dialExec(srv, "autotest-web-1234", testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected the idle session to be closed, got %v", err)
+	}
+}
+
+func TestExecProcessErrors(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	Store.CreateUser(&api.User{Username: "eve", Token: "eve-token"})
+	Scheduler.(*fake.Scheduler).ProcessList = map[string][]*api.Process{"autotest": {{Name: "autotest-web-1234", Type: "web"}}}
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+
+	tests := []struct {
+		process string
+		token   string
+		code    int
+	}{
+		{"autotest-web-1234", "nope", http.StatusUnauthorized},
+		{"autotest-web-1234", "eve-token", http.StatusForbidden},
+		{"autotest-web-5678", testToken, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		_, resp, err := dialExec(srv, tt.process, tt.token)
+		if err == nil {
+			t.Errorf("exec in %s with %s: expected the handshake to fail", tt.process, tt.token)
+			continue
+		}
+		if resp == nil || resp.StatusCode != tt.code {
+			t.Errorf("exec in %s with %s: %d expected, received %v", tt.process, tt.token, tt.code, resp)
+		}
+	}
+
+	// plain requests are turned away
+	r := httptest.NewRecorder()
+	req, err := newRequest("GET", "/apps/autotest/processes/autotest-web-1234/exec", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusBadRequest {
+		t.Errorf("%d expected, received %d", http.StatusBadRequest, r.Code)
+	}
+	if n := len(Scheduler.(*fake.Scheduler).Terminals()); n != 0 {
+		t.Errorf("expected no terminal to be opened, got %d", n)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getAppLimitsJSON returns the resources of each process type in the app's latest release.
+func getAppLimitsJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	limits := app.LatestRelease().Limits
+	if limits == nil {
+		limits = api.Limits{}
+	}
+	if err := WriteJSON(w, limits, http.StatusOK); err != nil {
+		log.Error(err)
+	}
+}
+
+// setLimits replaces the resources of the given process types, keeping those of every other
+// type, and publishes a new release with them. Process types given no resources lose their
+// requests and limits. Once a build is deployed, only the process types of its Procfile and the
+// one-off process type can be given resources. Responds with the new limits.
+func setLimits(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var changes api.Limits
+	if r.Body == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "no limits were supplied"})
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		writeError(w, r, decodeError(err))
+		return
+	}
+	if len(changes) == 0 {
+		writeError(w, r, &api.InvalidRequestError{Message: "no limits were supplied"})
+		return
+	}
+	if err := changes.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if build := app.LatestRelease().Build; build != nil {
+		for typ, res := range changes {
+			if _, ok := build.Procfile[typ]; !ok && typ != api.OneOffType && res != (api.Resources{}) {
+				writeError(w, r, &api.LimitsError{Type: typ, Message: "it is not a process type of the Procfile"})
+				return
+			}
+		}
+	}
+	limits := app.LatestRelease().Limits.Merge(changes)
+	release := app.NewRelease(nil, nil)
+	release.Limits = limits
+	release.Author = currentUser(r).Username
+	if !saveRelease(w, r, release) {
+		return
+	}
+	if err := release.Publish(Scheduler); err != nil {
+		observePublish(err)
+		if err != api.ErrNoBuildToPublish {
+			writeError(w, r, deployError(err))
+			return
+		}
+	}
+	if err := WriteJSON(w, release.Limits, http.StatusCreated); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+func TestSetLimits(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	app.NewRelease(&api.Build{
+		Image:    "deis/example-go:latest",
+		Procfile: map[string][]string{"web": {"./web"}, "worker": {"./worker"}},
+	}, nil)
+	Store.CreateApp(app)
+	scheduler := Scheduler.(*fake.Scheduler)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRecorder()
+		req, err := newRequest("POST", "/apps/autotest/limits", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		return r
+	}
+	r := post(`{"web":{"cpu_limit":"500m","memory_request":"256Mi","memory_limit":"512Mi"}}`)
+	if r.Code != http.StatusCreated {
+		t.Fatalf("%d Created expected, received %d: %s", http.StatusCreated, r.Code, r.Body.String())
+	}
+	r = post(`{"worker":{"memory_limit":"128Mi"}}`)
+	if r.Code != http.StatusCreated {
+		t.Fatalf("%d Created expected, received %d: %s", http.StatusCreated, r.Code, r.Body.String())
+	}
+	var limits api.Limits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		t.Fatal(err)
+	}
+	expected := api.Limits{
+		"web":    {CPULimit: "500m", MemoryRequest: "256Mi", MemoryLimit: "512Mi"},
+		"worker": {MemoryLimit: "128Mi"},
+	}
+	if !reflect.DeepEqual(limits, expected) {
+		t.Errorf("expected the limits to be merged into %v, got %v", expected, limits)
+	}
+
+	app, err = Store.GetApp("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := app.LatestRelease().Version; v != 4 {
+		t.Errorf("expected each change of limits to create a release, got v%d", v)
+	}
+	if deployed := scheduler.Releases["autotest"]; deployed == nil || !reflect.DeepEqual(deployed.Limits, expected) {
+		t.Errorf("expected the limits to be deployed, got %+v", deployed)
+	}
+
+	r = httptest.NewRecorder()
+	req, err := newRequest("GET", "/apps/autotest/limits", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	limits = nil
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(limits, expected) {
+		t.Errorf("expected GET to return %v, got %v", expected, limits)
+	}
+
+	// rolling back to v3 restores the limits from before the worker's were set
+	r = httptest.NewRecorder()
+	req, err = newRequest("POST", "/apps/autotest/releases/rollback", bytes.NewBufferString(`{"version":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusCreated {
+		t.Fatalf("%d Created expected, received %d: %s", http.StatusCreated, r.Code, r.Body.String())
+	}
+	var release api.Release
+	if err := json.NewDecoder(r.Body).Decode(&release); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := release.Limits["worker"]; ok || release.Limits["web"].MemoryLimit != "512Mi" {
+		t.Errorf("expected the rollback to restore v3's limits, got %v", release.Limits)
+	}
+	if deployed := scheduler.Releases["autotest"]; !reflect.DeepEqual(deployed.Limits, release.Limits) {
+		t.Errorf("expected the restored limits to be deployed, got %v", deployed.Limits)
+	}
+}
+
+func TestSetLimitsErrors(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	app.NewRelease(&api.Build{Image: "deis/example-go:latest", Procfile: map[string][]string{"web": {"./web"}}}, nil)
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	tests := []struct {
+		body  string
+		error string
+	}{
+		{`{}`, "invalid_request"},
+		{`{"web":`, "invalid_request"},
+		{`{"web":{"cpu_limit":"lots"}}`, "invalid_limits"},
+		{`{"web":{"memory_request":"1Gi","memory_limit":"512Mi"}}`, "invalid_limits"},
+		{`{"web":{"cpu_limit":"-1"}}`, "invalid_limits"},
+		{`{"clock":{"cpu_limit":"1"}}`, "invalid_limits"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRecorder()
+		req, err := newRequest("POST", "/apps/autotest/limits", bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		var resp errorResponse
+		json.NewDecoder(r.Body).Decode(&resp)
+		if r.Code != http.StatusBadRequest || resp.Code != tt.error {
+			t.Errorf("POST /apps/autotest/limits %s: expected 400 %s, got %d %s", tt.body, tt.error, r.Code, resp.Code)
+		}
+	}
+	app, err = Store.GetApp("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := app.LatestRelease().Version; v != 2 {
+		t.Errorf("expected no release to be created, got v%d", v)
+	}
+}
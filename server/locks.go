@@ -0,0 +1,47 @@
+package server
+
+import (
+	"sync"
+)
+
+// appLocks serializes changes to each app. Handlers which load an app, change it and save it
+// again hold the app's lock throughout, so that concurrent requests cannot both release the same
+// version or overwrite each other's changes.
+//
+// Each lock counts the requests holding or waiting for it, and is removed once there are none,
+// so that requests for IDs which are not apps do not leave locks behind.
+var appLocks = struct {
+	sync.Mutex
+	m map[string]*appLock
+}{m: make(map[string]*appLock)}
+
+type appLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockApp locks the app with the given ID and returns the function which unlocks it.
+func lockApp(id string) func() {
+	appLocks.Lock()
+	l, ok := appLocks.m[id]
+	if !ok {
+		l = &appLock{}
+		appLocks.m[id] = l
+	}
+	l.refs++
+	appLocks.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		appLocks.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(appLocks.m, id)
+		}
+		appLocks.Unlock()
+	}
+}
+
+// domainsLock serializes attaching domains to apps, so that two apps cannot both claim the same
+// domain. It is always taken after the app's lock.
+var domainsLock sync.Mutex
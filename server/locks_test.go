@@ -0,0 +1,39 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLockAppRemovesUnusedLocks(t *testing.T) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		holders int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := lockApp("autotest")
+			defer unlock()
+			mu.Lock()
+			holders++
+			if holders > 1 {
+				t.Error("expected a single holder of the lock at a time")
+			}
+			mu.Unlock()
+			mu.Lock()
+			holders--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	lockApp("missing")()
+
+	appLocks.Lock()
+	defer appLocks.Unlock()
+	if n := len(appLocks.m); n != 0 {
+		t.Errorf("expected every lock to be removed once released, got %d", n)
+	}
+}
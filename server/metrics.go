@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "api",
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "api",
+		Name:      "http_request_duration_seconds",
+		Help:      "How long HTTP requests took to handle, by route and method.",
+	}, []string{"route", "method"})
+	releasesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "api",
+		Name:      "releases_created_total",
+		Help:      "Number of releases added to the ledger of an app.",
+	})
+	publishFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "api",
+		Name:      "release_publish_failures_total",
+		Help:      "Number of releases which could not be published to the scheduler.",
+	})
+	schedulerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "api",
+		Name:      "scheduler_call_duration_seconds",
+		Help:      "How long calls to the scheduler took, by method.",
+	}, []string{"method"})
+	logStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "api",
+		Name:      "log_streams_active",
+		Help:      "Number of clients currently following the logs of an app.",
+	})
+	appsTotal = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "api",
+		Name:      "apps",
+		Help:      "Number of apps in the store.",
+	}, countApps)
+)
+
+var metricsHandler = promhttp.Handler()
+
+func init() {
+	prometheus.MustRegister(
+		requestsTotal,
+		requestDuration,
+		releasesCreated,
+		publishFailures,
+		schedulerDuration,
+		logStreams,
+		appsTotal,
+	)
+}
+
+// metrics responds with the metrics of the API in the Prometheus exposition format.
+func metrics(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// metricsMiddleware counts the requests to the route and how long they take. The route is the
+// pattern it was registered with, such as /apps/:id, which keeps the number of series bounded.
+func metricsMiddleware(route string) middleware {
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			h(sw, r, p)
+			requestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(sw.code())).Inc()
+			requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		}
+	}
+}
+
+// countApps returns the number of apps in the store for the apps gauge.
+func countApps() float64 {
+	n, err := Store.CountApps()
+	if err != nil {
+		log.Errorf("could not count apps: %v", err)
+		return 0
+	}
+	return float64(n)
+}
+
+// observePublish records the outcome of publishing a release. Releases without a build are
+// never published, so ErrNoBuildToPublish is not counted as a failure.
+func observePublish(err error) {
+	if err == nil || err == api.ErrNoBuildToPublish {
+		return
+	}
+	publishFailures.Inc()
+}
+
+// InstrumentScheduler wraps a scheduler so that the duration of every call to it is recorded in
+// the scheduler call metrics.
+func InstrumentScheduler(s api.Scheduler) api.Scheduler {
+	return &instrumentedScheduler{s}
+}
+
+type instrumentedScheduler struct {
+	api.Scheduler
+}
+
+// observe records the duration of a scheduler call which started at start.
+func (s *instrumentedScheduler) observe(method string, start time.Time) {
+	schedulerDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (s *instrumentedScheduler) CreateApp(app *api.App) error {
+	defer s.observe("CreateApp", time.Now())
+	return s.Scheduler.CreateApp(app)
+}
+
+func (s *instrumentedScheduler) Deploy(release *api.Release) error {
+	defer s.observe("Deploy", time.Now())
+	return s.Scheduler.Deploy(release)
+}
+
+func (s *instrumentedScheduler) Scale(app *api.App, structure map[string]int) error {
+	defer s.observe("Scale", time.Now())
+	return s.Scheduler.Scale(app, structure)
+}
+
+func (s *instrumentedScheduler) SetDomains(app *api.App) error {
+	defer s.observe("SetDomains", time.Now())
+	return s.Scheduler.SetDomains(app)
+}
+
+func (s *instrumentedScheduler) SetCert(app *api.App, cert *api.Cert) error {
+	defer s.observe("SetCert", time.Now())
+	return s.Scheduler.SetCert(app, cert)
+}
+
+func (s *instrumentedScheduler) RemoveCert(app *api.App, cert *api.Cert) error {
+	defer s.observe("RemoveCert", time.Now())
+	return s.Scheduler.RemoveCert(app, cert)
+}
+
+func (s *instrumentedScheduler) DeleteApp(app *api.App) error {
+	defer s.observe("DeleteApp", time.Now())
+	return s.Scheduler.DeleteApp(app)
+}
+
+func (s *instrumentedScheduler) AppDeleted(app *api.App) (bool, error) {
+	defer s.observe("AppDeleted", time.Now())
+	return s.Scheduler.AppDeleted(app)
+}
+
+func (s *instrumentedScheduler) Logs(app *api.App, opts api.LogOptions) (io.ReadCloser, error) {
+	defer s.observe("Logs", time.Now())
+	return s.Scheduler.Logs(app, opts)
+}
+
+func (s *instrumentedScheduler) Run(release *api.Release, command string) (api.OneOff, error) {
+	defer s.observe("Run", time.Now())
+	return s.Scheduler.Run(release, command)
+}
+
+func (s *instrumentedScheduler) Exec(app *api.App, process string, command []string) (api.Terminal, error) {
+	defer s.observe("Exec", time.Now())
+	return s.Scheduler.Exec(app, process, command)
+}
+
+func (s *instrumentedScheduler) Processes(app *api.App) ([]*api.Process, error) {
+	defer s.observe("Processes", time.Now())
+	return s.Scheduler.Processes(app)
+}
+
+func (s *instrumentedScheduler) RestartProcess(app *api.App, name string) error {
+	defer s.observe("RestartProcess", time.Now())
+	return s.Scheduler.RestartProcess(app, name)
+}
+
+func (s *instrumentedScheduler) Restart(ctx context.Context, release *api.Release, typ string, progress io.Writer) error {
+	defer s.observe("Restart", time.Now())
+	return s.Scheduler.Restart(ctx, release, typ, progress)
+}
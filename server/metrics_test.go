@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+func TestMetrics(t *testing.T) {
+	defer clearDB()
+	Scheduler = InstrumentScheduler(fake.New())
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	requests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"POST", "/apps", `{"id":"autotest"}`, http.StatusCreated},
+		{"GET", "/apps/missing", ``, http.StatusNotFound},
+		{"POST", "/apps/autotest/builds", `{"image":"deis/example-go:latest"}`, http.StatusCreated},
+	}
+	for _, tt := range requests {
+		r := httptest.NewRecorder()
+		req, err := newRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Fatalf("%s %s: %d expected, received %d: %s", tt.method, tt.path, tt.code, r.Code, r.Body.String())
+		}
+	}
+	// make the next deploy fail
+	Scheduler.(*instrumentedScheduler).Scheduler.(*fake.Scheduler).Err = errors.New("the cluster is on fire")
+	r := httptest.NewRecorder()
+	req, err := newRequest("POST", "/apps/autotest/builds", bytes.NewBufferString(`{"image":"deis/example-go:v2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusServiceUnavailable {
+		t.Fatalf("%d Service Unavailable expected, received %d", http.StatusServiceUnavailable, r.Code)
+	}
+
+	// metrics can be scraped without an API token
+	r = httptest.NewRecorder()
+	srv.ServeRequest(r, httptest.NewRequest("GET", "/metrics", nil))
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d", http.StatusOK, r.Code)
+	}
+	body := r.Body.String()
+	expected := []string{
+		`api_http_requests_total{method="POST",route="/apps",status="201"}`,
+		`api_http_requests_total{method="GET",route="/apps/:id",status="404"}`,
+		`api_http_request_duration_seconds_count{method="POST",route="/apps/:id/builds"}`,
+		`api_apps 1`,
+		`api_releases_created_total`,
+		`api_scheduler_call_duration_seconds_count{method="Deploy"}`,
+		`api_log_streams_active 0`,
+	}
+	for _, metric := range expected {
+		if !strings.Contains(body, metric) {
+			t.Errorf("expected %s to be exposed", metric)
+		}
+	}
+	if !regexp.MustCompile(`(?m)^api_release_publish_failures_total [1-9]`).MatchString(body) {
+		t.Error("expected the failed deploy to be counted")
+	}
+}
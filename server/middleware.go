@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pborman/uuid"
+)
+
+const requestIDKey contextKey = 1
+
+// requestIDRegexp matches the request IDs accepted from clients, so that they are safe to log and
+// to send back.
+var requestIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+// middleware wraps a handle to run code before or after it, or instead of it.
+type middleware func(httprouter.Handle) httprouter.Handle
+
+// publicMiddlewares wrap every route, including those which can be reached without an API token.
+// Routes behind authentication are also wrapped with authMiddlewares. The first middleware is the
+// outermost one.
+var (
+	publicMiddlewares = []middleware{requestIDMiddleware, logRequestMiddleware, recoverMiddleware, apiVersionMiddleware}
+	authMiddlewares   = []middleware{authMiddleware}
+)
+
+// chain wraps h with the given middlewares, the first one being the outermost.
+func chain(h httprouter.Handle, middlewares ...middleware) httprouter.Handle {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// handler turns a handle which takes no parameters into an http.Handler.
+func handler(h httprouter.Handle) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, nil)
+	})
+}
+
+// requestIDMiddleware tags the request with the ID in its X-Request-ID header, or with a new one
+// if it has none, and sends the ID back in the response's X-Request-ID header. The ID can be
+// retrieved with requestID.
+func requestIDMiddleware(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRegexp.MatchString(id) {
+			id = uuid.New()
+		}
+		w.Header().Set("X-Request-ID", id)
+		h(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)), p)
+	}
+}
+
+// requestID returns the ID of the request. It is only set on routes behind requestIDMiddleware.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// logRequestMiddleware logs every request once it has been handled, along with the status code
+// and size of the response and how long it took.
+func logRequestMiddleware(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h(sw, r, p)
+		log.WithFields(log.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     sw.code(),
+			"bytes":      sw.bytes,
+			"latency":    time.Since(start).Seconds(),
+			"request_id": requestID(r),
+		}).Info("handled request")
+	}
+}
+
+// recoverMiddleware turns a panic in the handler into a 500 Internal Server Error, so that one
+// bad request cannot take the server down. The panic is logged with the ID of the request.
+func recoverMiddleware(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer func() {
+			if rcv := recover(); rcv != nil {
+				log.WithField("request_id", requestID(r)).Errorf("panic: %v\n%s", rcv, debug.Stack())
+				writeError(w, r, errors.New("internal server error"))
+			}
+		}()
+		h(w, r, p)
+	}
+}
+
+// statusWriter records the status code and the number of bytes of a response. It passes
+// flushing, close notifications and hijacking through to the underlying ResponseWriter, which
+// streaming log and exec handlers rely on.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// code returns the status code of the response, which is 200 OK unless another one was written.
+func (w *statusWriter) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// CloseNotify returns a nil channel, which never fires, if the underlying ResponseWriter cannot
+// tell when the client goes away.
+func (w *statusWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("webserver doesn't support hijacking")
+}
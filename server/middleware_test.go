@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/julienschmidt/httprouter"
+)
+
+// logHook records the entries logged while it is installed.
+type logHook struct {
+	mu      sync.Mutex
+	entries []*log.Entry
+}
+
+func (h *logHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *logHook) Fire(entry *log.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+// find returns the first entry with the given message.
+func (h *logHook) find(message string) *log.Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.entries {
+		if e.Message == message {
+			return e
+		}
+	}
+	return nil
+}
+
+func withLogHook(fn func(hook *logHook)) {
+	hook := &logHook{}
+	log.AddHook(hook)
+	defer func() { log.StandardLogger().Hooks = make(log.LevelHooks) }()
+	fn(hook)
+}
+
+func TestRequestIDs(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	r := httptest.NewRecorder()
+	req, err := newRequest("GET", "/apps/missing", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	id := r.Header().Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("expected a request ID to be assigned")
+	}
+	var body errorResponse
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID != id {
+		t.Errorf("expected the error to carry request ID %s, got %s", id, body.RequestID)
+	}
+
+	for header, expected := range map[string]string{"abc-123": "abc-123", "not\nsafe": ""} {
+		r := httptest.NewRecorder()
+		req, err := newRequest("GET", "/_ping", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Request-ID", header)
+		srv.ServeRequest(r, req)
+		got := r.Header().Get("X-Request-ID")
+		if expected != "" && got != expected {
+			t.Errorf("expected request ID %q to be kept, got %q", header, got)
+		}
+		if expected == "" && (got == "" || got == header) {
+			t.Errorf("expected request ID %q to be replaced, got %q", header, got)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	withLogHook(func(hook *logHook) {
+		r := httptest.NewRecorder()
+		req, err := newRequest("GET", "/_ping", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Request-ID", "ping-1")
+		srv.ServeRequest(r, req)
+		entry := hook.find("handled request")
+		if entry == nil {
+			t.Fatal("expected the request to be logged")
+		}
+		expected := log.Fields{"method": "GET", "path": "/_ping", "status": http.StatusOK, "bytes": 4, "request_id": "ping-1"}
+		for k, v := range expected {
+			if entry.Data[k] != v {
+				t.Errorf("expected %s=%v to be logged, got %v", k, v, entry.Data[k])
+			}
+		}
+		if _, ok := entry.Data["latency"].(float64); !ok {
+			t.Errorf("expected the latency to be logged, got %v", entry.Data["latency"])
+		}
+	})
+}
+
+func TestRecoverFromPanics(t *testing.T) {
+	h := chain(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		panic("oops")
+	}, publicMiddlewares...)
+	withLogHook(func(hook *logHook) {
+		r := httptest.NewRecorder()
+		h(r, httptest.NewRequest("GET", "/boom", nil), nil)
+		if r.Code != http.StatusInternalServerError {
+			t.Fatalf("%d Internal Server Error expected, received %d", http.StatusInternalServerError, r.Code)
+		}
+		var body errorResponse
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Code != "internal_error" || body.RequestID == "" || body.RequestID != r.Header().Get("X-Request-ID") {
+			t.Errorf("expected an internal_error with the request ID, got %+v", body)
+		}
+		if entry := hook.find("handled request"); entry == nil || entry.Data["status"] != http.StatusInternalServerError {
+			t.Errorf("expected the request to be logged with a 500, got %v", entry)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/store"
+	"github.com/julienschmidt/httprouter"
+)
+
+// perms is the response body of the perms endpoints.
+type perms struct {
+	Owner         string   `json:"owner"`
+	Collaborators []string `json:"collaborators"`
+}
+
+func permsFor(app *api.App) perms {
+	collaborators := app.Collaborators
+	if collaborators == nil {
+		collaborators = []string{}
+	}
+	return perms{Owner: app.Owner, Collaborators: collaborators}
+}
+
+// getSharableApp looks up the app named in the request parameters, which only its owner or an
+// admin may share. If the app cannot be found or shared by the user who made the request, the
+// appropriate error has already been written to the response and nil is returned.
+func getSharableApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) *api.App {
+	app := getApp(w, r, p)
+	if app == nil {
+		return nil
+	}
+	if user := currentUser(r); !user.Admin && user.Username != app.Owner {
+		writeError(w, r, &api.ForbiddenError{Message: fmt.Sprintf("only the owner of %s can change who can access it", app)})
+		return nil
+	}
+	return app
+}
+
+// getAppPermsJSON responds with the owner of the app and the users it is shared with.
+func getAppPermsJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if app := getApp(w, r, p); app != nil {
+		if err := WriteJSON(w, permsFor(app), http.StatusOK); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// addCollaborator shares the app with another user.
+func addCollaborator(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var form struct {
+		Username string `json:"username"`
+	}
+	if r.Body == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "a username is required"})
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		writeError(w, r, decodeError(err))
+		return
+	}
+	defer lockApp(p.ByName("id"))()
+	app := getSharableApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if _, err := Store.GetUser(form.Username); err != nil {
+		if err == store.ErrUserNotFound {
+			writeError(w, r, &api.NotFoundError{Kind: "user", ID: form.Username})
+		} else {
+			writeError(w, r, fmt.Errorf("could not load user: %v", err))
+		}
+		return
+	}
+	if err := app.AddCollaborator(form.Username); err != nil {
+		writeError(w, r, &api.ConflictError{Kind: "collaborator", Message: fmt.Sprintf("could not share app with %s: %v", form.Username, err)})
+		return
+	}
+	if err := Store.UpdateApp(app); err != nil {
+		writeError(w, r, fmt.Errorf("could not save app: %v", err))
+		return
+	}
+	if err := WriteJSON(w, permsFor(app), http.StatusCreated); err != nil {
+		log.Error(err)
+	}
+}
+
+// removeCollaborator stops sharing the app with a user.
+func removeCollaborator(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	defer lockApp(p.ByName("id"))()
+	app := getSharableApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if err := app.RemoveCollaborator(p.ByName("user")); err != nil {
+		writeError(w, r, &api.NotFoundError{Kind: "collaborator", ID: p.ByName("user")})
+		return
+	}
+	if err := Store.UpdateApp(app); err != nil {
+		writeError(w, r, fmt.Errorf("could not save app: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
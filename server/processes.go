@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+type processesByName []*api.Process
+
+func (p processesByName) Len() int           { return len(p) }
+func (p processesByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p processesByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+
+// getAppProcessesJSON lists the app's processes as reported by the scheduler, grouped by process
+// type and sorted by name.
+func getAppProcessesJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	procs, err := Scheduler.Processes(app)
+	if err != nil {
+		writeError(w, r, &api.SchedulerError{Message: "could not list processes: " + err.Error()})
+		return
+	}
+	if len(procs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	byType := make(map[string][]*api.Process)
+	for _, proc := range procs {
+		byType[proc.Type] = append(byType[proc.Type], proc)
+	}
+	for _, procs := range byType {
+		sort.Sort(processesByName(procs))
+	}
+	if err := WriteJSON(w, byType, http.StatusOK); err != nil {
+		log.Error(err)
+	}
+}
+
+// restartProcess stops one of the app's processes, which the scheduler replaces with a new one
+// running the same release.
+func restartProcess(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	name := p.ByName("name")
+	if err := Scheduler.RestartProcess(app, name); err != nil {
+		if _, ok := err.(*api.NotFoundError); !ok {
+			err = &api.SchedulerError{Message: "could not restart process: " + err.Error()}
+		}
+		writeError(w, r, err)
+		return
+	}
+	log.Infof("%s restarted %s of %s", currentUser(r), name, app)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restartApp restarts the processes of the app's latest release, or only those of the process
+// type given by the type query parameter, without creating a new release. Processes are replaced
+// a few at a time, and progress is streamed back as lines of text until every new process is up.
+// Since the status code has been sent by then, a failure is reported by a last line starting
+// with "error:".
+func restartApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	release := app.LatestRelease()
+	if release.Build == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "no build has been deployed yet"})
+		return
+	}
+	typ := r.URL.Query().Get("type")
+	if _, ok := release.Build.Procfile[typ]; typ != "" && !ok {
+		writeError(w, r, &api.NotFoundError{Kind: "process type", ID: typ})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errors.New("webserver doesn't support streaming"))
+		return
+	}
+
+	log.Infof("%s is restarting %s v%d", currentUser(r), app, release.Version)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// stop waiting for the restart once the client goes away. A shutdown lets it finish within the
+	// shutdown timeout.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	defer closeOnDisconnect(w, r, cancelCloser(cancel), nil)()
+	if err := Scheduler.Restart(ctx, release, typ, &flushWriter{w, flusher}); err != nil {
+		log.Errorf("could not restart %s: %v", app, err)
+		fmt.Fprintf(w, "error: %v\n", err)
+	}
+}
+
+// cancelCloser cancels a context when it is closed, so that closeOnDisconnect can cancel it.
+type cancelCloser context.CancelFunc
+
+func (c cancelCloser) Close() error {
+	c()
+	return nil
+}
+
+// flushWriter flushes every write to the client, so that progress is seen as it happens.
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	fw.flusher.Flush()
+	return n, err
+}
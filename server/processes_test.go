@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+func TestGetAppProcesses(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	r := httptest.NewRecorder()
+	req, err := newRequest("GET", "/apps/autotest/processes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusNoContent {
+		t.Errorf("expected %d with no processes running, got %d", http.StatusNoContent, r.Code)
+	}
+
+	Scheduler.(*fake.Scheduler).ProcessList = map[string][]*api.Process{
+		"autotest": {
+			{Name: "autotest-web-2", Type: "web", Version: 2, State: api.ProcessUp},
+			{Name: "autotest-worker-1", Type: "worker", Version: 2, State: api.ProcessCrashed, Restarts: 5},
+			{Name: "autotest-web-1", Type: "web", Version: 2, State: api.ProcessStarting},
+		},
+	}
+	r = httptest.NewRecorder()
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d: %s", http.StatusOK, r.Code, r.Body.String())
+	}
+	var procs map[string][]*api.Process
+	if err := json.NewDecoder(r.Body).Decode(&procs); err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("expected processes grouped in 2 types, got %v", procs)
+	}
+	web := procs["web"]
+	if len(web) != 2 || web[0].Name != "autotest-web-1" || web[1].Name != "autotest-web-2" {
+		t.Errorf("expected the web processes sorted by name, got %+v", web)
+	}
+	worker := procs["worker"]
+	if len(worker) != 1 || worker[0].State != api.ProcessCrashed || worker[0].Restarts != 5 {
+		t.Errorf("expected the crashed worker, got %+v", worker)
+	}
+}
+
+func TestRestartProcess(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	scheduler := Scheduler.(*fake.Scheduler)
+	scheduler.ProcessList = map[string][]*api.Process{
+		"autotest": {{Name: "autotest-web-1", Type: "web"}},
+	}
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	for _, code := range []int{http.StatusNoContent, http.StatusNotFound} {
+		r := httptest.NewRecorder()
+		req, err := newRequest("DELETE", "/apps/autotest/processes/autotest-web-1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != code {
+			t.Errorf("%d expected, received %d: %s", code, r.Code, r.Body.String())
+		}
+	}
+	calls := scheduler.CallsTo("RestartProcess")
+	if len(calls) != 2 || calls[0].Process != "autotest-web-1" {
+		t.Errorf("expected autotest-web-1 to be restarted, got %+v", calls)
+	}
+	if len(scheduler.ProcessList["autotest"]) != 0 {
+		t.Errorf("expected the process to be stopped, got %+v", scheduler.ProcessList["autotest"])
+	}
+}
+
+func TestRestartApp(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	app.NewRelease(&api.Build{
+		Image:    "deis/example-go:latest",
+		Procfile: map[string][]string{"web": {"./web"}, "worker": {"./worker"}},
+	}, nil)
+	Store.CreateApp(app)
+	scheduler := Scheduler.(*fake.Scheduler)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	tests := []struct {
+		url  string
+		code int
+		body string
+	}{
+		{"/apps/autotest/restart", http.StatusOK, "web: restarted\nworker: restarted\n"},
+		{"/apps/autotest/restart?type=worker", http.StatusOK, "worker: restarted\n"},
+		{"/apps/autotest/restart?type=clock", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRecorder()
+		req, err := newRequest("POST", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("POST %s: %d expected, received %d: %s", tt.url, tt.code, r.Code, r.Body.String())
+		}
+		if tt.code == http.StatusOK && r.Body.String() != tt.body {
+			t.Errorf("POST %s: expected progress %q, got %q", tt.url, tt.body, r.Body.String())
+		}
+	}
+	calls := scheduler.CallsTo("Restart")
+	if len(calls) != 2 || calls[0].Type != "" || calls[1].Type != "worker" || calls[1].Release != 2 {
+		t.Errorf("expected v2 to be restarted twice, got %+v", calls)
+	}
+	app, err = Store.GetApp("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(app.Ledger) != 2 {
+		t.Errorf("expected no new release, got %d releases", len(app.Ledger))
+	}
+
+	// the restart is abandoned once the request is over
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRecorder()
+	req, err := newRequest("POST", "/apps/autotest/restart", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req.WithContext(ctx))
+	if r.Body.String() != "error: context canceled\n" {
+		t.Errorf("expected the restart to be canceled, got %q", r.Body.String())
+	}
+
+	// failures once the restart has begun are reported in the body
+	scheduler.Err = errors.New("deployment is stuck")
+	r = httptest.NewRecorder()
+	srv.ServeRequest(r, req)
+	if r.Body.String() != "error: deployment is stuck\n" {
+		t.Errorf("expected the error to be reported, got %q", r.Body.String())
+	}
+}
+
+func TestRestartAppWithoutBuild(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	r := httptest.NewRecorder()
+	req, err := newRequest("POST", "/apps/autotest/restart", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusBadRequest {
+		t.Errorf("%d expected, received %d", http.StatusBadRequest, r.Code)
+	}
+}
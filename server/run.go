@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+// exitCodeTrailer is the trailer which carries the exit code of a one-off process, since the
+// status code has long been sent by the time the process exits.
+const exitCodeTrailer = "X-Deis-Exit-Code"
+
+// runApp runs a one-off command, such as a database migration, against the app's latest release.
+// The output of the command is streamed back as it is written, and its exit code is sent in the
+// X-Deis-Exit-Code trailer once it exits. The process is stopped if the client goes away, but not
+// when the server shuts down: it is given the shutdown timeout to finish.
+func runApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var form struct {
+		Command string `json:"command"`
+	}
+	if r.Body == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "a command is required"})
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		writeError(w, r, decodeError(err))
+		return
+	}
+	if strings.TrimSpace(form.Command) == "" {
+		writeError(w, r, &api.InvalidRequestError{Message: "a command is required"})
+		return
+	}
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	release := app.LatestRelease()
+	if release.Build == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "no build has been deployed yet"})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errors.New("webserver doesn't support streaming"))
+		return
+	}
+
+	proc, err := Scheduler.Run(release, form.Command)
+	if err != nil {
+		writeError(w, r, &api.SchedulerError{Message: "could not run command: " + err.Error()})
+		return
+	}
+	defer proc.Close()
+	defer closeOnDisconnect(w, r, proc, nil)()
+	log.Infof("%s is running %q on %s v%d", currentUser(r), form.Command, app, release.Version)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Trailer", exitCodeTrailer)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	buf := make([]byte, 4096)
+	for {
+		n, err := proc.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Errorf("could not read the output of %q on %s: %v", form.Command, app, err)
+			return
+		}
+	}
+	code, err := proc.ExitCode()
+	if err != nil {
+		log.Errorf("could not get the exit code of %q on %s: %v", form.Command, app, err)
+		return
+	}
+	w.Header().Set(exitCodeTrailer, strconv.Itoa(code))
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+func TestRunApp(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	app.NewRelease(&api.Build{Image: "deis/example-go:latest"}, nil)
+	Store.CreateApp(app)
+	scheduler := Scheduler.(*fake.Scheduler)
+	scheduler.RunOutput = "migrating...\ndone\n"
+	scheduler.RunExitCode = 3
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+
+	req, err := newRequest("POST", "http://"+srv.l.Addr().String()+"/apps/autotest/run", bytes.NewBufferString(`{"command":"rake db:migrate"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d", http.StatusOK, resp.StatusCode)
+	}
+	output, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "migrating...\ndone\n" {
+		t.Errorf("expected the output to be streamed, got %q", output)
+	}
+	// trailers are only available once the body has been read
+	if code := resp.Trailer.Get("X-Deis-Exit-Code"); code != "3" {
+		t.Errorf("expected exit code 3, got %q", code)
+	}
+	calls := scheduler.CallsTo("Run")
+	if len(calls) != 1 || calls[0].Command != "rake db:migrate" || calls[0].Release != 2 {
+		t.Errorf("expected the command to run against v2, got %+v", calls)
+	}
+	if len(scheduler.Removed) != 1 {
+		t.Errorf("expected the one-off process to be removed, got %v", scheduler.Removed)
+	}
+}
+
+func TestRunAppErrors(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"command":""}`, http.StatusBadRequest},
+		{`{"command":`, http.StatusBadRequest},
+		// no build has been deployed yet
+		{`{"command":"rake db:migrate"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRecorder()
+		req, err := newRequest("POST", "/apps/autotest/run", bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("POST /apps/autotest/run %s: %d expected, received %d: %s", tt.body, tt.code, r.Code, r.Body.String())
+		}
+	}
+	if calls := Scheduler.(*fake.Scheduler).CallsTo("Run"); len(calls) != 0 {
+		t.Errorf("expected nothing to run, got %+v", calls)
+	}
+}
+
+func TestRunAppFinishesOnShutdown(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	app.NewRelease(&api.Build{Image: "deis/example-go:latest"}, nil)
+	Store.CreateApp(app)
+	scheduler := Scheduler.(*fake.Scheduler)
+	scheduler.RunOutput = "migrating...\n"
+	scheduler.RunDone = make(chan struct{})
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Close()
+
+	req, err := newRequest("POST", "http://"+srv.l.Addr().String()+"/apps/autotest/run", bytes.NewBufferString(`{"command":"rake db:migrate"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "migrating...\n" {
+		t.Fatalf("expected the output to be streamed, got %q (%v)", line, err)
+	}
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(5 * time.Second) }()
+	<-srv.stopping
+	// give a shutdown which wrongly stops the process the time to do so
+	time.Sleep(50 * time.Millisecond)
+	close(scheduler.RunDone)
+	if _, err := ioutil.ReadAll(reader); err != nil {
+		t.Fatal(err)
+	}
+	if code := resp.Trailer.Get("X-Deis-Exit-Code"); code != "0" {
+		t.Errorf("expected the command to run to completion, got exit code %q", code)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("expected shutdown to wait for the command, got %v", err)
+	}
+}
@@ -1,29 +1,53 @@
 package server
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/fishworks/api"
+	"github.com/fishworks/api/store"
 	"github.com/julienschmidt/httprouter"
 )
 
-var (
-	Apps    []*api.App
-	Builds  []*api.Build
-	Configs []*api.Config
-)
+// Store is where the server persists apps, builds, configs and releases. It defaults to an
+// in-memory store; set it before calling New to use something more durable.
+var Store store.Store = store.NewMemoryStore()
+
+// Scheduler runs the apps managed by the server. It must be set before the server starts
+// handling requests.
+var Scheduler api.Scheduler
+
+// deleteTimeout is how long deleting an app waits for it to be torn down on the scheduler.
+var deleteTimeout = 5 * time.Minute
+
+// deletePollInterval is how often the scheduler is asked whether a deleted app is gone yet.
+var deletePollInterval = time.Second
 
 // HTTPServer is an API Server which listens and responds to HTTP requests.
 type HTTPServer struct {
 	srv *http.Server
 	l   net.Listener
+	// certs is the certificate served by https listeners.
+	certs *certReloader
+
+	// mu guards starting requests against shutting down, see track.
+	mu       sync.RWMutex
+	inflight sync.WaitGroup
+	stopping chan struct{}
+	stopOnce sync.Once
 }
 
 // Serve starts the HTTP server, accepting all new connections.
@@ -31,7 +55,8 @@ func (s *HTTPServer) Serve() error {
 	return s.srv.Serve(s.l)
 }
 
-// Close shuts down the HTTP server, dropping all current connections.
+// Close shuts down the HTTP server, dropping all current connections. Use Shutdown to let the
+// requests in flight finish first.
 func (s *HTTPServer) Close() error {
 	return s.l.Close()
 }
@@ -48,25 +73,23 @@ func New(proto, addr string) (*HTTPServer, error) {
 		return setupTCPHTTP(addr)
 	case "unix":
 		return setupUnixHTTP(addr)
+	case "https", "tls":
+		return setupTLSHTTP(addr)
 	default:
 		return nil, fmt.Errorf("Invalid protocol format.")
 	}
 }
 
 func setupTCPHTTP(addr string) (*HTTPServer, error) {
-	r := createRouter()
-
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return &HTTPServer{&http.Server{Addr: addr, Handler: r}, l}, nil
+	return newHTTPServer(addr, l), nil
 }
 
 func setupUnixHTTP(addr string) (*HTTPServer, error) {
-	r := createRouter()
-
 	if err := syscall.Unlink(addr); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
@@ -82,57 +105,128 @@ func setupUnixHTTP(addr string) (*HTTPServer, error) {
 		return nil, err
 	}
 
-	return &HTTPServer{&http.Server{Addr: addr, Handler: r}, l}, nil
+	return newHTTPServer(addr, l), nil
 }
 
-func getApp(id string) *api.App {
-	for _, app := range Apps {
-		if app.ID == id {
-			return app
+// getApp looks up the app named in the request parameters. If it cannot be found or the user
+// who made the request may not access it, the appropriate error has already been written to the
+// response and nil is returned.
+func getApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) *api.App {
+	app, err := Store.GetApp(p.ByName("id"))
+	if err != nil {
+		if err == store.ErrAppNotFound {
+			writeError(w, r, &api.NotFoundError{Kind: "app", ID: p.ByName("id")})
+		} else {
+			writeError(w, r, fmt.Errorf("could not load app: %v", err))
 		}
+		return nil
 	}
-	return nil
+	if user := currentUser(r); !app.CanAccess(user) {
+		writeError(w, r, &api.ForbiddenError{Message: fmt.Sprintf("user %s may not access app %s", user, app)})
+		return nil
+	}
+	return app
+}
+
+// saveRelease appends the release to its app's ledger in the store. If it cannot, the
+// appropriate error has already been written to the response and false is returned.
+func saveRelease(w http.ResponseWriter, r *http.Request, release *api.Release) bool {
+	if err := Store.AddRelease(release); err != nil {
+		if err != store.ErrVersionConflict {
+			err = fmt.Errorf("could not save release: %v", err)
+		}
+		writeError(w, r, err)
+		return false
+	}
+	releasesCreated.Inc()
+	return true
 }
 
 func createRouter() *httprouter.Router {
 	r := httprouter.New()
+	r.NotFound = handler(chain(notFound, publicMiddlewares...))
+	r.MethodNotAllowed = handler(chain(methodNotAllowed, publicMiddlewares...))
+
+	// routes which can be reached without an API token
+	publicRoutes := map[string]map[string]httprouter.Handle{
+		"GET": {
+			"/_ping":   ping,
+			"/metrics": metrics,
+			"/version": getVersion,
+		},
+		"POST": {
+			"/auth/register": register,
+			"/auth/login":    login,
+		},
+	}
 
 	routerMap := map[string]map[string]httprouter.Handle{
 		"GET": {
-			"/_ping":           ping,
-			"/apps":            getAppsJSON,
-			"/apps/:id":        getAppJSON,
-			"/apps/:id/builds": getAppBuildsJSON,
-			"/apps/:id/config": getAppConfigJSON,
-			"/apps/:id/logs":   getAppLogs,
+			"/auth/whoami":      whoami,
+			"/apps":             getAppsJSON,
+			"/apps/:id":         getAppJSON,
+			"/apps/:id/builds":  getAppBuildsJSON,
+			"/apps/:id/config":  getAppConfigJSON,
+			"/apps/:id/logs":    getAppLogs,
+			"/apps/:id/perms":   getAppPermsJSON,
+			"/apps/:id/domains": getAppDomainsJSON,
+			"/apps/:id/certs":   getAppCertsJSON,
+
+			"/apps/:id/releases":          getAppReleasesJSON,
+			"/apps/:id/releases/:version": getAppReleaseJSON,
+
+			"/apps/:id/limits":               getAppLimitsJSON,
+			"/apps/:id/processes":            getAppProcessesJSON,
+			"/apps/:id/processes/:name/exec": execProcess,
 		},
 		"POST": {
-			"/apps":            createApp,
-			"/apps/:id/builds": createBuild,
-			"/apps/:id/config": createConfig,
+			"/apps":             createApp,
+			"/apps/:id/builds":  createBuild,
+			"/apps/:id/config":  createConfig,
+			"/apps/:id/scale":   scaleApp,
+			"/apps/:id/perms":   addCollaborator,
+			"/apps/:id/domains": addDomain,
+			"/apps/:id/certs":   addCert,
+			"/apps/:id/run":     runApp,
+			"/apps/:id/restart": restartApp,
+			"/apps/:id/limits":  setLimits,
+
+			"/apps/:id/releases/rollback": rollbackApp,
+		},
+		"PUT": {
+			"/apps/:id/config": replaceConfig,
 		},
 		"DELETE": {
-			"/apps/:id": deleteApp,
+			"/apps/:id":                 deleteApp,
+			"/apps/:id/config/:key":     unsetConfig,
+			"/apps/:id/perms/:user":     removeCollaborator,
+			"/apps/:id/domains/:domain": removeDomain,
+			"/apps/:id/certs/:name":     removeCert,
+			"/apps/:id/processes/:name": restartProcess,
 		},
 	}
 
+	authenticated := append(publicMiddlewares[:len(publicMiddlewares):len(publicMiddlewares)], authMiddlewares...)
+	// every route is served under the API version prefix, and without it as an alias
+	handle := func(method, route string, h httprouter.Handle) {
+		h = metricsMiddleware(route)(h)
+		r.Handle(method, apiPrefix+route, h)
+		r.Handle(method, route, h)
+	}
+	for method, routes := range publicRoutes {
+		for route, funct := range routes {
+			handle(method, route, chain(funct, publicMiddlewares...))
+		}
+	}
 	for method, routes := range routerMap {
 		for route, funct := range routes {
-			r.Handle(method, route, logRequestMiddleware(funct))
+			handle(method, route, chain(funct, authenticated...))
 		}
 	}
 
 	return r
 }
 
-func logRequestMiddleware(h httprouter.Handle) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		log.Infof("%s %s", r.Method, r.RequestURI)
-		// Delegate request to the given handle
-		h(w, r, p)
-	}
-}
-
 // WriteJSON writes the value v to the http response stream as json with standard
 // json encoding.
 func WriteJSON(w http.ResponseWriter, v interface{}, code int) error {
@@ -145,36 +239,45 @@ func ping(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	w.Write([]byte{'P', 'O', 'N', 'G'})
 }
 
+// getAppsJSON lists the apps the user who made the request can access.
 func getAppsJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	if len(Apps) == 0 {
+	all, err := Store.Apps()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("could not list applications: %v", err))
+		return
+	}
+	user := currentUser(r)
+	var apps []*api.App
+	for _, app := range all {
+		if app.CanAccess(user) {
+			apps = append(apps, app)
+		}
+	}
+	if len(apps) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 	} else {
-		if err := WriteJSON(w, Apps, http.StatusOK); err != nil {
+		if err := WriteJSON(w, apps, http.StatusOK); err != nil {
 			log.Error(err)
 		}
 	}
 }
 
 func getAppJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	if app := getApp(p.ByName("id")); app != nil {
+	if app := getApp(w, r, p); app != nil {
 		if err := WriteJSON(w, app, http.StatusOK); err != nil {
 			log.Error(err)
 		}
-	} else {
-		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
 func getAppBuildsJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	var builds []*api.Build
-	if app := getApp(p.ByName("id")); app != nil {
-		for _, build := range Builds {
-			if build.App == app {
-				builds = append(builds, build)
-			}
-		}
-	} else {
-		w.WriteHeader(http.StatusNotFound)
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	builds, err := Store.Builds(app.ID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("could not list builds: %v", err))
 		return
 	}
 
@@ -188,14 +291,102 @@ func getAppBuildsJSON(w http.ResponseWriter, r *http.Request, p httprouter.Param
 }
 
 func getAppConfigJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	if app := getApp(p.ByName("id")); app != nil {
+	if app := getApp(w, r, p); app != nil {
 		if err := WriteJSON(w, app.LatestRelease().Config, http.StatusOK); err != nil {
 			log.Error(err)
 		}
-	} else {
-		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// releasesByVersion sorts releases from newest to oldest.
+type releasesByVersion []*api.Release
+
+func (r releasesByVersion) Len() int           { return len(r) }
+func (r releasesByVersion) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r releasesByVersion) Less(i, j int) bool { return r[i].Version > r[j].Version }
+
+func getAppReleasesJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	releases, err := Store.Releases(app.ID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("could not list releases: %v", err))
+		return
+	}
+	sort.Sort(releasesByVersion(releases))
+	if err := WriteJSON(w, releases, http.StatusOK); err != nil {
+		log.Error(err)
+	}
+}
+
+func getAppReleaseJSON(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// accept both "3" and "v3"
+	version, err := strconv.Atoi(strings.TrimPrefix(p.ByName("version"), "v"))
+	if err != nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "invalid release version " + p.ByName("version")})
 		return
 	}
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	release := app.Release(version)
+	if release == nil {
+		writeError(w, r, &api.NotFoundError{Kind: "release", ID: fmt.Sprintf("v%d", version)})
+		return
+	}
+	if err := WriteJSON(w, release, http.StatusOK); err != nil {
+		log.Error(err)
+	}
+}
+
+func rollbackApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var form struct {
+		Version int `json:"version"`
+	}
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+			// the request body is always non-nil (except in tests) but will return EOF immediately when no body is present.
+			// http://golang.org/pkg/net/http/#Request
+			if err != io.EOF {
+				writeError(w, r, decodeError(err))
+				return
+			}
+		}
+	}
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	version := form.Version
+	if version == 0 {
+		// roll back to the release before the current one
+		version = app.LatestRelease().Version - 1
+	}
+	release, err := app.Rollback(version, Scheduler)
+	if release == nil {
+		if err == api.ErrReleaseNotFound {
+			err = &api.NotFoundError{Kind: "release", ID: fmt.Sprintf("v%d", version)}
+		}
+		writeError(w, r, err)
+		return
+	}
+	// the release is returned even if publishing it failed, so save it before reporting the failure
+	observePublish(err)
+	release.Author = currentUser(r).Username
+	if !saveRelease(w, r, release) {
+		return
+	}
+	if err != nil && err != api.ErrNoBuildToPublish {
+		writeError(w, r, deployError(err))
+		return
+	}
+	if err := WriteJSON(w, release, http.StatusCreated); err != nil {
+		log.Error(err)
+	}
 }
 
 func createApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -212,29 +403,56 @@ func createApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 			// the request body is always non-nil (except in tests) but will return EOF immediately when no body is present.
 			// http://golang.org/pkg/net/http/#Request
 			if err != io.EOF {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("could not decode request: " + err.Error()))
+				writeError(w, r, decodeError(err))
 				return
 			}
 		}
-		app, err = api.NewApp(form.ID)
+		if form.ID != "" {
+			// keep concurrent requests for the same ID from cleaning up after each other below
+			defer lockApp(form.ID)()
+		}
+		app, err = api.NewApp(form.ID, Scheduler)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("could not create application: " + err.Error()))
+			writeError(w, r, newAppError(err))
 			return
 		}
 	} else {
-		app, err = api.NewApp("")
+		app, err = api.NewApp("", Scheduler)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("could not create application: " + err.Error()))
+			writeError(w, r, newAppError(err))
 			return
 		}
 	}
-	Apps = append(Apps, app)
+	app.Owner = currentUser(r).Username
+	app.LatestRelease().Author = app.Owner
+	if err := Store.CreateApp(app); err != nil {
+		if err == store.ErrAppExists {
+			// the scheduler's side of the app belongs to the app which already exists
+			err = &api.ConflictError{Kind: "app", Message: fmt.Sprintf("app %s already exists", app)}
+		} else {
+			// don't leave the scheduler's side of an app which was never saved behind
+			if err := Scheduler.DeleteApp(app); err != nil {
+				log.Errorf("could not delete %s from the scheduler: %v", app, err)
+			}
+			err = fmt.Errorf("could not create application: %v", err)
+		}
+		writeError(w, r, err)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
+// newAppError turns an error from api.NewApp into the error reported to the client. Invalid IDs
+// and namespaces taken by something else are the client's doing; anything else is the
+// scheduler's.
+func newAppError(err error) error {
+	switch err.(type) {
+	case *api.AppError, *api.ConflictError:
+		return err
+	}
+	return &api.SchedulerError{Message: "could not create application: " + err.Error()}
+}
+
 func createBuild(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	var build *api.Build
 	if r.Body != nil {
@@ -243,120 +461,324 @@ func createBuild(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 			// the request body is always non-nil (except in tests) but will return EOF immediately when no body is present.
 			// http://golang.org/pkg/net/http/#Request
 			if err != io.EOF {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("could not decode request: " + err.Error()))
+				writeError(w, r, decodeError(err))
 				return
 			}
 		}
-		app := getApp(p.ByName("id"))
+		if build == nil {
+			writeError(w, r, &api.InvalidRequestError{Message: "a build is required"})
+			return
+		}
+		if err := build.Validate(); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer lockApp(p.ByName("id"))()
+		app := getApp(w, r, p)
 		if app == nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("could not find app with id " + p.ByName("id")))
 			return
 		}
 		// attach app to build
 		build.App = app
-		// add build to in-memory list
-		Builds = append(Builds, build)
+		if err := Store.AddBuild(build); err != nil {
+			writeError(w, r, fmt.Errorf("could not save build: %v", err))
+			return
+		}
 		release := app.NewRelease(build, nil)
-		if err := release.Publish(); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			w.Write([]byte(fmt.Sprintf("there was an error deploying this release: %v", err)))
+		release.Author = currentUser(r).Username
+		if !saveRelease(w, r, release) {
+			return
+		}
+		if err := release.Publish(Scheduler); err != nil {
+			observePublish(err)
+			writeError(w, r, deployError(err))
 			return
 		}
 	} else {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, &api.InvalidRequestError{Message: "a build is required"})
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
 }
 
-func createConfig(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+// decodeConfig reads a config from the request body. If it cannot, the appropriate error has
+// already been written to the response and nil is returned.
+func decodeConfig(w http.ResponseWriter, r *http.Request) *api.Config {
 	var config *api.Config
 	if r.Body != nil {
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&config); err != nil {
-			// the request body is always non-nil (except in tests) but will return EOF immediately when no body is present.
-			// http://golang.org/pkg/net/http/#Request
-			if err != io.EOF {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("could not decode request: " + err.Error()))
-				return
-			}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil && err != io.EOF {
+			writeError(w, r, decodeError(err))
+			return nil
 		}
-		app := getApp(p.ByName("id"))
-		if app == nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte("could not find app with id " + p.ByName("id")))
-			return
+	}
+	if config == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "no config values were supplied"})
+		return nil
+	}
+	for _, v := range config.Values {
+		if v.Name == "" {
+			writeError(w, r, &api.InvalidRequestError{Message: "config values must have a name"})
+			return nil
 		}
+	}
+	return config
+}
 
-		// before adding, merge new config with old (if it exists)
-		if oldRelease := app.LatestRelease(); oldRelease != nil {
-			if oldRelease.Config != nil {
-				mergedConfig := oldRelease.Config.Values
-				for k, v := range config.Values {
-					mergedConfig[k] = v
-				}
-				config.Values = mergedConfig
-			}
+// createConfig sets the given config values, keeping every other value of the current config.
+func createConfig(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	config := decodeConfig(w, r)
+	if config == nil {
+		return
+	}
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	releaseConfig(w, r, app, app.LatestRelease().Config.Merge(config.Values))
+}
+
+// replaceConfig replaces the current config with the given config values.
+func replaceConfig(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	config := decodeConfig(w, r)
+	if config == nil {
+		return
+	}
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	// merging into an empty config drops duplicate names
+	releaseConfig(w, r, app, new(api.Config).Merge(config.Values))
+}
+
+// unsetConfig removes a single value from the current config.
+func unsetConfig(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	key := p.ByName("key")
+	current := app.LatestRelease().Config
+	if _, ok := current.Get(key); !ok {
+		writeError(w, r, &api.NotFoundError{Kind: "config value", ID: key})
+		return
+	}
+	releaseConfig(w, r, app, current.Unset(key))
+}
+
+// releaseConfig saves the config and publishes a new release with it, then responds with the
+// new config.
+func releaseConfig(w http.ResponseWriter, r *http.Request, app *api.App, config *api.Config) {
+	// attach app to config
+	config.App = app
+	if err := Store.AddConfig(config); err != nil {
+		writeError(w, r, fmt.Errorf("could not save config: %v", err))
+		return
+	}
+	release := app.NewRelease(nil, config)
+	release.Author = currentUser(r).Username
+	if !saveRelease(w, r, release) {
+		return
+	}
+	if err := release.Publish(Scheduler); err != nil {
+		observePublish(err)
+		if err != api.ErrNoBuildToPublish {
+			writeError(w, r, deployError(err))
+			return
 		}
+	}
+	if err := WriteJSON(w, config, http.StatusCreated); err != nil {
+		log.Error(err)
+	}
+}
 
-		// attach app to config
-		config.App = app
-		// add build to in-memory list
-		Configs = append(Configs, config)
-		release := app.NewRelease(nil, config)
-		if err := release.Publish(); err != nil {
-			if err != api.ErrNoBuildToPublish {
-				w.WriteHeader(http.StatusServiceUnavailable)
-				w.Write([]byte(fmt.Sprintf("there was an error deploying this release: %v", err)))
-				return
-			}
+func scaleApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var structure map[string]int
+	if r.Body == nil {
+		writeError(w, r, &api.InvalidRequestError{Message: "a process structure is required"})
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&structure); err != nil {
+		writeError(w, r, decodeError(err))
+		return
+	}
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	if err := app.Scale(structure, Scheduler); err != nil {
+		if _, ok := err.(*api.ScaleError); !ok {
+			err = &api.SchedulerError{Message: "could not scale app: " + err.Error()}
 		}
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	if err := Store.UpdateApp(app); err != nil {
+		writeError(w, r, fmt.Errorf("could not save app: %v", err))
+		return
+	}
+	if err := WriteJSON(w, app, http.StatusOK); err != nil {
+		log.Error(err)
+	}
 }
 
+// getAppLogs returns the logs of the app's processes. The logs can be narrowed down with the
+// "type" and "lines" query parameters. With "follow=true", new lines are streamed to the client
+// using chunked transfer encoding until the client disconnects. Only the processes running when
+// the stream starts are followed; processes started later, by a deploy or a scale, are not.
 func getAppLogs(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	follow := r.URL.Query().Get("follow")
-	for _, app := range Apps {
-		if app.ID == p.ByName("id") {
-			// hijack the connection if we want to "follow" the logs
-			if follow == "true" {
-				hj, ok := w.(http.Hijacker)
-				if !ok {
-					http.Error(w, "webserver doesn't support hijacking", http.StatusInternalServerError)
-					return
-				}
-				conn, bufrw, err := hj.Hijack()
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				defer conn.Close()
-				// watch app logs
-				bufrw.ReadString('\n')
-			} else {
-				// serve app logs
-				w.WriteHeader(http.StatusOK)
+	query := r.URL.Query()
+	opts := api.LogOptions{
+		Type:   query.Get("type"),
+		Follow: query.Get("follow") == "true",
+	}
+	if lines := query.Get("lines"); lines != "" {
+		n, err := strconv.Atoi(lines)
+		if err != nil || n < 0 {
+			writeError(w, r, &api.InvalidRequestError{Message: "lines must be a non-negative number"})
+			return
+		}
+		opts.Lines = n
+	}
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if opts.Follow && !ok {
+		writeError(w, r, errors.New("webserver doesn't support streaming"))
+		return
+	}
+
+	logs, err := Scheduler.Logs(app, opts)
+	if err != nil {
+		writeError(w, r, &api.SchedulerError{Message: "could not retrieve logs: " + err.Error()})
+		return
+	}
+	defer logs.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if !opts.Follow {
+		if _, err := io.Copy(w, logs); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	// stop following once the client goes away or the server shuts down, which unblocks the read
+	// below.
+	defer closeOnDisconnect(w, r, logs, shuttingDown(r))()
+	logStreams.Inc()
+	defer logStreams.Dec()
+	flusher.Flush()
+	reader := bufio.NewReader(logs)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, err := w.Write(line); err != nil {
 				return
 			}
+			flusher.Flush()
+		}
+		if err != nil {
 			return
 		}
 	}
-	w.WriteHeader(http.StatusNotFound)
 }
 
+// closeOnDisconnect closes c when the client goes away, or when stop is closed, which unblocks a
+// handler streaming from c. A nil stop is never closed. The returned function stops watching;
+// call it once the handler is done with c.
+func closeOnDisconnect(w http.ResponseWriter, r *http.Request, c io.Closer, stop <-chan struct{}) func() {
+	done := make(chan struct{})
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	go func() {
+		select {
+		case <-closed:
+			c.Close()
+		case <-r.Context().Done():
+			c.Close()
+		case <-stop:
+			c.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// deleteApp tears the app down on the scheduler and purges it, along with its builds, configs and
+// releases, from the store. Tearing down continues in the background: the response is 202
+// Accepted and the outcome is logged. With "wait=true", the response is only sent once the app is
+// gone from the scheduler, or with 504 Gateway Timeout if that takes longer than deleteTimeout.
 func deleteApp(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	for i, app := range Apps {
-		if app.ID == p.ByName("id") {
-			Apps = append(Apps[:i], Apps[i+1:]...)
-			w.WriteHeader(http.StatusNoContent)
+	wait := r.URL.Query().Get("wait") == "true"
+	defer lockApp(p.ByName("id"))()
+	app := getApp(w, r, p)
+	if app == nil {
+		return
+	}
+	// the teardown may outlive the request, so don't read the package variables from it
+	scheduler, timeout, interval := Scheduler, deleteTimeout, deletePollInterval
+	if err := scheduler.DeleteApp(app); err != nil {
+		writeError(w, r, &api.SchedulerError{Message: "could not delete application: " + err.Error()})
+		return
+	}
+	if err := Store.DeleteApp(app.ID); err != nil {
+		writeError(w, r, fmt.Errorf("could not delete application: %v", err))
+		return
+	}
+	if !wait {
+		go func() {
+			if err := waitForTeardown(scheduler, app, timeout, interval); err != nil {
+				log.Errorf("could not tear down %s: %v", app, err)
+				return
+			}
+			log.Infof("tore down %s", app)
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err := waitForTeardown(scheduler, app, timeout, interval); err != nil {
+		writeError(w, r, &api.TimeoutError{Message: fmt.Sprintf("app %s was deleted, but tearing it down did not complete: %v", app, err)})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deployError wraps an error from publishing a release to the scheduler.
+func deployError(err error) error {
+	return &api.SchedulerError{Message: fmt.Sprintf("there was an error deploying this release: %v", err)}
+}
+
+// decodeError wraps an error from decoding a request body.
+func decodeError(err error) error {
+	return &api.InvalidRequestError{Message: "could not decode request: " + err.Error()}
+}
+
+// waitForTeardown polls the scheduler every interval until the app is gone from it, or until the
+// timeout expires.
+func waitForTeardown(scheduler api.Scheduler, app *api.App, timeout, interval time.Duration) error {
+	expired := time.After(timeout)
+	for {
+		deleted, err := scheduler.AppDeleted(app)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			return nil
+		}
+		select {
+		case <-expired:
+			return fmt.Errorf("timed out after %v", timeout)
+		case <-time.After(interval):
 		}
 	}
-	w.WriteHeader(http.StatusNotFound)
 }
@@ -2,17 +2,59 @@ package server
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+	"github.com/fishworks/api/store"
 )
 
+func init() {
+	clearDB()
+}
+
+// testToken authenticates requests made with newRequest.
+const testToken = "0123456789abcdef"
+
 func clearDB() {
-	Apps = Apps[:0]
+	Store = store.NewMemoryStore()
+	Scheduler = fake.New()
+	Store.CreateUser(&api.User{Username: "autotest", Token: testToken})
+}
+
+// newRequest creates a request which is authenticated as the "autotest" user.
+func newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+testToken)
+	return req, nil
+}
+
+func apps(t *testing.T) []*api.App {
+	apps, err := Store.Apps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apps
 }
 
 func TestEmptyListAppsReturnsNoContent(t *testing.T) {
@@ -22,7 +64,7 @@ func TestEmptyListAppsReturnsNoContent(t *testing.T) {
 	}
 	defer srv.Close()
 	r := httptest.NewRecorder()
-	req, err := http.NewRequest("GET", "/apps", nil)
+	req, err := newRequest("GET", "/apps", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -40,7 +82,7 @@ func TestCreateAppAndThenList(t *testing.T) {
 	}
 	defer srv.Close()
 	r := httptest.NewRecorder()
-	req, err := http.NewRequest("POST", "/apps", nil)
+	req, err := newRequest("POST", "/apps", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -49,7 +91,7 @@ func TestCreateAppAndThenList(t *testing.T) {
 		t.Fatalf("%d CREATED expected, received %d\n", http.StatusCreated, r.Code)
 	}
 	r = httptest.NewRecorder()
-	req, err = http.NewRequest("GET", "/apps", nil)
+	req, err = newRequest("GET", "/apps", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -57,8 +99,8 @@ func TestCreateAppAndThenList(t *testing.T) {
 	if r.Code != http.StatusOK {
 		t.Fatalf("%d OK expected, received %d\n", http.StatusOK, r.Code)
 	}
-	if len(Apps) != 1 {
-		t.Fatalf("%d app expected, got %d", 1, len(Apps))
+	if len(apps(t)) != 1 {
+		t.Fatalf("%d app expected, got %d", 1, len(apps(t)))
 	}
 }
 
@@ -70,7 +112,7 @@ func TestCreateAppWithID(t *testing.T) {
 	}
 	defer srv.Close()
 	r := httptest.NewRecorder()
-	req, err := http.NewRequest("POST", "/apps", bytes.NewBuffer([]byte(`{"id":"autotest"}`)))
+	req, err := newRequest("POST", "/apps", bytes.NewBuffer([]byte(`{"id":"autotest"}`)))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -78,23 +120,72 @@ func TestCreateAppWithID(t *testing.T) {
 	if r.Code != http.StatusCreated {
 		t.Fatalf("%d CREATED expected, received %d\n", http.StatusCreated, r.Code)
 	}
-	if Apps[0].ID != "autotest" {
-		t.Errorf("%s expected, received %s\n", "autotest", Apps[0].ID)
+	if apps(t)[0].ID != "autotest" {
+		t.Errorf("%s expected, received %s\n", "autotest", apps(t)[0].ID)
+	}
+}
+
+// failingStore fails to create apps.
+type failingStore struct {
+	store.Store
+}
+
+func (s failingStore) CreateApp(app *api.App) error {
+	return errors.New("disk is full")
+}
+
+func TestCreateAppCleansUpTheScheduler(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	create := func() int {
+		r := httptest.NewRecorder()
+		req, err := newRequest("POST", "/apps", bytes.NewBufferString(`{"id":"autotest"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		return r.Code
+	}
+	scheduler := Scheduler.(*fake.Scheduler)
+
+	// the app which already exists keeps its namespace
+	if code := create(); code != http.StatusCreated {
+		t.Fatalf("%d CREATED expected, received %d", http.StatusCreated, code)
+	}
+	if code := create(); code != http.StatusConflict {
+		t.Errorf("%d CONFLICT expected, received %d", http.StatusConflict, code)
+	}
+	if !scheduler.Apps["autotest"] || len(scheduler.CallsTo("DeleteApp")) != 0 {
+		t.Error("expected the existing app to be left alone on the scheduler")
+	}
+
+	// an app which could not be saved is removed from the scheduler
+	Store = failingStore{Store}
+	if code := create(); code != http.StatusInternalServerError {
+		t.Errorf("%d INTERNAL SERVER ERROR expected, received %d", http.StatusInternalServerError, code)
+	}
+	if calls := scheduler.CallsTo("DeleteApp"); len(calls) != 1 || calls[0].App != "autotest" {
+		t.Errorf("expected autotest to be deleted from the scheduler, got %+v", calls)
 	}
 }
 
 // TestGetAppRemovesUUID tests that an application's UUID does not show up in the response body.
 func TestGetAppRemovesUUID(t *testing.T) {
 	defer clearDB()
-	app, _ := api.NewApp("autotest")
-	Apps = append(Apps, app)
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
 	srv, err := New("tcp", "0.0.0.0:4567")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer srv.Close()
 	r := httptest.NewRecorder()
-	req, err := http.NewRequest("GET", "/apps/autotest", nil)
+	req, err := newRequest("GET", "/apps/autotest", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,16 +204,19 @@ func TestGetAppRemovesUUID(t *testing.T) {
 
 func TestGetAppLogs(t *testing.T) {
 	defer clearDB()
-	app, _ := api.NewApp("autotest")
-	Apps = append(Apps, app)
-	app.Log("ohai der =3")
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	Scheduler.(*fake.Scheduler).LogLines = map[string][]string{
+		"autotest": []string{"deis[api]: ohai der =3"},
+	}
 	srv, err := New("tcp", "0.0.0.0:4567")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer srv.Close()
 	r := httptest.NewRecorder()
-	req, err := http.NewRequest("GET", "/apps/autotest/logs", nil)
+	req, err := newRequest("GET", "/apps/autotest/logs", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -137,15 +231,16 @@ func TestGetAppLogs(t *testing.T) {
 
 func TestDeleteApp(t *testing.T) {
 	defer clearDB()
-	app, _ := api.NewApp("autotest")
-	Apps = append(Apps, app)
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
 	srv, err := New("tcp", "0.0.0.0:4567")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer srv.Close()
 	r := httptest.NewRecorder()
-	req, err := http.NewRequest("DELETE", "/apps/autotest", nil)
+	req, err := newRequest("DELETE", "/apps/autotest?wait=true", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -153,7 +248,895 @@ func TestDeleteApp(t *testing.T) {
 	if r.Code != http.StatusNoContent {
 		t.Fatalf("%d NO CONTENT expected, received %d\n", http.StatusNoContent, r.Code)
 	}
-	if len(Apps) != 0 {
-		t.Fatalf("%d expected, received %d\n", 0, len(Apps))
+	if len(apps(t)) != 0 {
+		t.Fatalf("%d expected, received %d\n", 0, len(apps(t)))
+	}
+	if Scheduler.(*fake.Scheduler).Apps["autotest"] {
+		t.Errorf("expected the app to be torn down on the scheduler")
+	}
+}
+
+func TestDeleteAppInTheBackground(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	Store.AddBuild(&api.Build{App: app, Image: "deis/example-go:latest"})
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	r := httptest.NewRecorder()
+	req, err := newRequest("DELETE", "/apps/autotest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusAccepted {
+		t.Fatalf("%d ACCEPTED expected, received %d\n", http.StatusAccepted, r.Code)
+	}
+	if len(Scheduler.(*fake.Scheduler).CallsTo("DeleteApp")) != 1 {
+		t.Errorf("expected the app to be deleted on the scheduler")
+	}
+	// re-creating the app starts from scratch
+	r = httptest.NewRecorder()
+	req, err = newRequest("POST", "/apps", bytes.NewBufferString(`{"id":"autotest"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusCreated {
+		t.Fatalf("%d CREATED expected, received %d\n", http.StatusCreated, r.Code)
+	}
+	builds, err := Store.Builds("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases, err := Store.Releases("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds) != 0 || len(releases) != 1 {
+		t.Errorf("expected builds and releases to be purged, got %d builds and %d releases", len(builds), len(releases))
+	}
+}
+
+func TestDeleteAppTimesOut(t *testing.T) {
+	defer clearDB()
+	defer func(timeout, interval time.Duration) {
+		deleteTimeout, deletePollInterval = timeout, interval
+	}(deleteTimeout, deletePollInterval)
+	deleteTimeout, deletePollInterval = 50*time.Millisecond, 10*time.Millisecond
+
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	Scheduler.(*fake.Scheduler).Terminating = map[string]bool{"autotest": true}
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	r := httptest.NewRecorder()
+	req, err := newRequest("DELETE", "/apps/autotest?wait=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusGatewayTimeout {
+		t.Fatalf("%d GATEWAY TIMEOUT expected, received %d\n", http.StatusGatewayTimeout, r.Code)
+	}
+	if len(Scheduler.(*fake.Scheduler).CallsTo("AppDeleted")) < 2 {
+		t.Errorf("expected the scheduler to be polled until the timeout")
+	}
+}
+
+func TestScaleApp(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	r := httptest.NewRecorder()
+	req, err := newRequest("POST", "/apps/autotest/builds", bytes.NewBufferString(`{"image":"deis/example-go:latest","procfile":{"web":["/bin/boot"],"worker":["/bin/work"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusCreated {
+		t.Fatalf("%d CREATED expected, received %d\n", http.StatusCreated, r.Code)
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("POST", "/apps/autotest/scale", bytes.NewBufferString(`{"web":3,"worker":0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d: %s\n", http.StatusOK, r.Code, r.Body.String())
+	}
+	calls := Scheduler.(*fake.Scheduler).CallsTo("Scale")
+	if len(calls) != 1 || calls[0].Structure["web"] != 3 {
+		t.Errorf("expected web to be scaled to 3 on the scheduler, got %v", calls)
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("GET", "/apps/autotest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	var app2 api.App
+	if err := json.Unmarshal(r.Body.Bytes(), &app2); err != nil {
+		t.Fatal(err)
+	}
+	if app2.Structure["web"] != 3 || app2.Structure["worker"] != 0 {
+		t.Errorf("expected structure to be reported, got %v", app2.Structure)
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("POST", "/apps/autotest/scale", bytes.NewBufferString(`{"cron":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusBadRequest {
+		t.Fatalf("%d BAD REQUEST expected for an unknown process type, received %d\n", http.StatusBadRequest, r.Code)
+	}
+}
+
+func TestReleasesAndRollback(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	for _, image := range []string{"deis/example-go:v1", "deis/example-go:v2"} {
+		r := httptest.NewRecorder()
+		req, err := newRequest("POST", "/apps/autotest/builds", bytes.NewBufferString(`{"image":"`+image+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != http.StatusCreated {
+			t.Fatalf("%d CREATED expected, received %d\n", http.StatusCreated, r.Code)
+		}
+	}
+
+	r := httptest.NewRecorder()
+	req, err := newRequest("GET", "/apps/autotest/releases", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d\n", http.StatusOK, r.Code)
+	}
+	var releases []api.Release
+	if err := json.Unmarshal(r.Body.Bytes(), &releases); err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 3 || releases[0].Version != 3 {
+		t.Fatalf("expected 3 releases, newest first, got %v", releases)
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("GET", "/apps/autotest/releases/v2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d\n", http.StatusOK, r.Code)
+	}
+	var release api.Release
+	if err := json.Unmarshal(r.Body.Bytes(), &release); err != nil {
+		t.Fatal(err)
+	}
+	if release.Build == nil || release.Build.Image != "deis/example-go:v1" {
+		t.Errorf("expected v2 to be released with deis/example-go:v1, got %v", release.Build)
+	}
+	if release.Created.IsZero() {
+		t.Error("expected the release's creation time to be reported")
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("GET", "/apps/autotest/releases/v9", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusNotFound {
+		t.Fatalf("%d NOT FOUND expected, received %d\n", http.StatusNotFound, r.Code)
+	}
+
+	// rolling back without a version goes back to the previous release
+	r = httptest.NewRecorder()
+	req, err = newRequest("POST", "/apps/autotest/releases/rollback", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusCreated {
+		t.Fatalf("%d CREATED expected, received %d: %s\n", http.StatusCreated, r.Code, r.Body.String())
+	}
+	if err := json.Unmarshal(r.Body.Bytes(), &release); err != nil {
+		t.Fatal(err)
+	}
+	if release.Version != 4 || release.Build.Image != "deis/example-go:v1" {
+		t.Errorf("expected v4 to be released with deis/example-go:v1, got v%d with %v", release.Version, release.Build)
+	}
+	if deployed := Scheduler.(*fake.Scheduler).Releases["autotest"]; deployed.Version != 4 {
+		t.Errorf("expected v4 to be deployed, got v%d", deployed.Version)
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("POST", "/apps/autotest/releases/rollback", bytes.NewBufferString(`{"version":42}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusNotFound {
+		t.Fatalf("%d NOT FOUND expected, received %d\n", http.StatusNotFound, r.Code)
+	}
+}
+
+func TestFollowAppLogs(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	Scheduler.(*fake.Scheduler).LogLines = map[string][]string{
+		"autotest": []string{"autotest-web-1: one", "autotest-web-1: two"},
+	}
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	r := httptest.NewRecorder()
+	req, err := newRequest("GET", "/apps/autotest/logs?follow=true&type=web&lines=10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d\n", http.StatusOK, r.Code)
+	}
+	if r.Body.String() != "autotest-web-1: one\nautotest-web-1: two\n" {
+		t.Errorf("expected both lines to be streamed, received %q", r.Body.String())
+	}
+	calls := Scheduler.(*fake.Scheduler).CallsTo("Logs")
+	if len(calls) != 1 {
+		t.Fatalf("expected logs to be requested once, got %d", len(calls))
+	}
+	if opts := calls[0].LogOptions; !opts.Follow || opts.Type != "web" || opts.Lines != 10 {
+		t.Errorf("expected follow, type=web and lines=10 to be passed on, got %+v", opts)
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("GET", "/apps/autotest/logs?lines=-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusBadRequest {
+		t.Fatalf("%d BAD REQUEST expected, received %d\n", http.StatusBadRequest, r.Code)
+	}
+}
+
+func TestConfigSetUnsetAndReplace(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	requests := []struct {
+		method, path, body string
+		code               int
+		expected           map[string]string
+	}{
+		{"POST", "/apps/autotest/config", `{"values":[{"name":"FOO","value":"foo"},{"name":"BAR","value":"bar"}]}`, http.StatusCreated, map[string]string{"FOO": "foo", "BAR": "bar"}},
+		{"POST", "/apps/autotest/config", `{"values":[{"name":"BAR","value":"baz"}]}`, http.StatusCreated, map[string]string{"FOO": "foo", "BAR": "baz"}},
+		{"DELETE", "/apps/autotest/config/FOO", "", http.StatusCreated, map[string]string{"BAR": "baz"}},
+		{"DELETE", "/apps/autotest/config/FOO", "", http.StatusNotFound, map[string]string{"BAR": "baz"}},
+		{"PUT", "/apps/autotest/config", `{"values":[{"name":"QUX","value":"qux"}]}`, http.StatusCreated, map[string]string{"QUX": "qux"}},
+		{"POST", "/apps/autotest/config", `{"values":[{"value":"nameless"}]}`, http.StatusBadRequest, map[string]string{"QUX": "qux"}},
+	}
+	for _, tt := range requests {
+		r := httptest.NewRecorder()
+		req, err := newRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Fatalf("%s %s: %d expected, received %d: %s", tt.method, tt.path, tt.code, r.Code, r.Body.String())
+		}
+		app, err := Store.GetApp("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := app.LatestRelease().Config
+		if len(config.Values) != len(tt.expected) {
+			t.Errorf("%s %s: expected %v, got %v", tt.method, tt.path, tt.expected, config.Values)
+		}
+		for k, v := range tt.expected {
+			if got, _ := config.Get(k); got != v {
+				t.Errorf("%s %s: expected %s=%s, got %s", tt.method, tt.path, k, v, got)
+			}
+		}
+	}
+	// every change is a new release: the initial release plus four config changes
+	app, err = Store.GetApp("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Ledger.Len() != 5 {
+		t.Errorf("expected 5 releases, got %d", app.Ledger.Len())
+	}
+}
+
+// TestConcurrentReleases fires builds, config changes and rollbacks at the same app in parallel
+// and checks that the ledger ends up strictly monotonic and gap-free. Run it with -race.
+func TestConcurrentReleases(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	// v2 is the release rolled back to, so it needs a build
+	app.NewRelease(&api.Build{Image: "deis/example-go:latest"}, nil)
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	requests := []struct{ method, path, body string }{
+		{"POST", "/apps/autotest/builds", `{"image":"deis/example-go:latest","procfile":{"web":["/bin/boot"]}}`},
+		{"POST", "/apps/autotest/config", `{"values":[{"name":"FOO","value":"bar"}]}`},
+		{"PUT", "/apps/autotest/config", `{"values":[{"name":"BAR","value":"baz"}]}`},
+		{"POST", "/apps/autotest/releases/rollback", `{"version":2}`},
+	}
+	const rounds = 25
+	var wg sync.WaitGroup
+	errs := make(chan error, rounds*len(requests))
+	for i := 0; i < rounds; i++ {
+		for _, rr := range requests {
+			wg.Add(1)
+			go func(method, path, body string) {
+				defer wg.Done()
+				r := httptest.NewRecorder()
+				req, err := newRequest(method, path, bytes.NewBufferString(body))
+				if err != nil {
+					errs <- err
+					return
+				}
+				srv.ServeRequest(r, req)
+				if r.Code != http.StatusCreated {
+					errs <- fmt.Errorf("%s %s: %d CREATED expected, received %d: %s", method, path, http.StatusCreated, r.Code, r.Body.String())
+				}
+			}(rr.method, rr.path, rr.body)
+		}
+		// read while writing, too
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRecorder()
+			req, _ := newRequest("GET", "/apps/autotest/releases", nil)
+			srv.ServeRequest(r, req)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	releases, err := Store.Releases("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := 2 + rounds*len(requests)
+	if len(releases) != expected {
+		t.Fatalf("expected %d releases, got %d", expected, len(releases))
+	}
+	var versions []int
+	for _, r := range releases {
+		versions = append(versions, r.Version)
+	}
+	sort.Ints(versions)
+	for i, v := range versions {
+		if v != i+1 {
+			t.Fatalf("expected versions 1 to %d without gaps or duplicates, got %v", expected, versions)
+		}
+	}
+}
+
+func TestRequestsMustBeAuthenticated(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	for _, header := range []string{"", "token nope", "Bearer " + testToken, "token"} {
+		r := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/apps", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: %d UNAUTHORIZED expected, received %d", header, http.StatusUnauthorized, r.Code)
+		}
+	}
+	if len(apps(t)) != 0 {
+		t.Errorf("expected no apps to be created without a valid token")
+	}
+
+	// pinging does not need a token
+	r := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/_ping", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Errorf("%d OK expected, received %d", http.StatusOK, r.Code)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/auth/register", `{"username":"bacongobbler","password":"s3cr3t"}`, http.StatusCreated},
+		{"/auth/register", `{"username":"bacongobbler","password":"other"}`, http.StatusConflict},
+		{"/auth/register", `{"username":"no spaces","password":"s3cr3t"}`, http.StatusBadRequest},
+		{"/auth/register", `{"username":"nopassword"}`, http.StatusBadRequest},
+		{"/auth/login", `{"username":"bacongobbler","password":"wrong"}`, http.StatusUnauthorized},
+		{"/auth/login", `{"username":"nobody","password":"s3cr3t"}`, http.StatusUnauthorized},
+		{"/auth/login", `{"username":"bacongobbler","password":"s3cr3t"}`, http.StatusOK},
+	}
+	var r *httptest.ResponseRecorder
+	for _, tt := range tests {
+		r = httptest.NewRecorder()
+		req, err := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("POST %s %s: %d expected, received %d: %s", tt.path, tt.body, tt.code, r.Code, r.Body.String())
+		}
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(r.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+	if login.Token == "" {
+		t.Fatal("expected login to return a token")
+	}
+
+	r = httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/auth/whoami", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "token "+login.Token)
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d", http.StatusOK, r.Code)
+	}
+	var user api.User
+	if err := json.Unmarshal(r.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "bacongobbler" || user.Admin {
+		t.Errorf("expected to be logged in as non-admin bacongobbler, got %+v", user)
+	}
+}
+
+func TestUnknownUserCostsAsMuchAsAUser(t *testing.T) {
+	user, err := api.NewUser("autotest", "s3cr3t", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the prefix holds the bcrypt version and cost, which decide how long a check takes
+	if prefix := string(user.PasswordHash[:7]); !strings.HasPrefix(string(unknownUser.PasswordHash), prefix) {
+		t.Errorf("expected the unknown user's hash to start with %s like a user's, got %s", prefix, unknownUser.PasswordHash)
+	}
+	if unknownUser.CheckPassword("") || unknownUser.CheckPassword("s3cr3t") {
+		t.Error("expected no password to match the unknown user")
+	}
+}
+
+func TestReleasesRecordTheirAuthor(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/apps", `{"id":"autotest"}`},
+		{"POST", "/apps/autotest/builds", `{"image":"deis/example-go:latest"}`},
+		{"POST", "/apps/autotest/config", `{"values":[{"name":"FOO","value":"bar"}]}`},
+		{"POST", "/apps/autotest/releases/rollback", ``},
+	} {
+		r := httptest.NewRecorder()
+		req, err := newRequest(req.method, req.path, bytes.NewBufferString(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != http.StatusCreated {
+			t.Fatalf("%s %s: %d CREATED expected, received %d: %s", req.Method, req.URL, http.StatusCreated, r.Code, r.Body.String())
+		}
+	}
+	releases, err := Store.Releases("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 4 {
+		t.Fatalf("expected 4 releases, got %d", len(releases))
+	}
+	for _, release := range releases {
+		if release.Author != "autotest" {
+			t.Errorf("expected v%d to be authored by autotest, got %q", release.Version, release.Author)
+		}
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	Store = store.NewMemoryStore()
+	defer clearDB()
+	if err := BootstrapAdmin("admin", "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := Store.GetUser("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !admin.Admin || !admin.CheckPassword("s3cr3t") {
+		t.Errorf("expected admin to be an admin with the given password, got %+v", admin)
+	}
+	// once a user exists, bootstrapping does nothing
+	if err := BootstrapAdmin("root", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Store.GetUser("root"); err != store.ErrUserNotFound {
+		t.Errorf("expected no second admin to be created, got %v", err)
+	}
+}
+
+func TestBootstrapAdminWithGeneratedPassword(t *testing.T) {
+	Store = store.NewMemoryStore()
+	defer clearDB()
+	var out bytes.Buffer
+	defer func(w io.Writer) { generatedPasswordOutput = w }(generatedPasswordOutput)
+	generatedPasswordOutput = &out
+
+	withLogHook(func(hook *logHook) {
+		if err := BootstrapAdmin("admin", ""); err != nil {
+			t.Fatal(err)
+		}
+		password := strings.TrimPrefix(strings.TrimSpace(out.String()), "generated password for admin user admin: ")
+		admin, err := Store.GetUser("admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if password == "" || !admin.CheckPassword(password) {
+			t.Errorf("expected the generated password to be written out, got %q", out.String())
+		}
+		hook.mu.Lock()
+		defer hook.mu.Unlock()
+		for _, entry := range hook.entries {
+			if strings.Contains(entry.Message, password) {
+				t.Errorf("expected the password to be kept out of the logs, got %q", entry.Message)
+			}
+		}
+	})
+}
+
+func TestAppPermissions(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	Store.CreateUser(&api.User{Username: "friend", Token: "friend-token"})
+	Store.CreateUser(&api.User{Username: "stranger", Token: "stranger-token"})
+	Store.CreateUser(&api.User{Username: "admin", Token: "admin-token", Admin: true})
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{testToken, "POST", "/apps", `{"id":"autotest"}`, http.StatusCreated},
+		{"stranger-token", "GET", "/apps/autotest", ``, http.StatusForbidden},
+		{"stranger-token", "POST", "/apps/autotest/builds", `{"image":"deis/example-go:latest"}`, http.StatusForbidden},
+		{"stranger-token", "DELETE", "/apps/autotest", ``, http.StatusForbidden},
+		{"stranger-token", "GET", "/apps", ``, http.StatusNoContent},
+		{"friend-token", "POST", "/apps/autotest/config", `{"values":[{"name":"FOO","value":"bar"}]}`, http.StatusForbidden},
+		{testToken, "POST", "/apps/autotest/perms", `{"username":"nobody"}`, http.StatusNotFound},
+		{testToken, "POST", "/apps/autotest/perms", `{"username":"friend"}`, http.StatusCreated},
+		{testToken, "POST", "/apps/autotest/perms", `{"username":"friend"}`, http.StatusConflict},
+		{"friend-token", "POST", "/apps/autotest/config", `{"values":[{"name":"FOO","value":"bar"}]}`, http.StatusCreated},
+		{"friend-token", "GET", "/apps", ``, http.StatusOK},
+		{"friend-token", "GET", "/apps/autotest/perms", ``, http.StatusOK},
+		// only the owner (or an admin) can share the app
+		{"friend-token", "POST", "/apps/autotest/perms", `{"username":"stranger"}`, http.StatusForbidden},
+		{"friend-token", "DELETE", "/apps/autotest/perms/friend", ``, http.StatusForbidden},
+		{"admin-token", "GET", "/apps/autotest", ``, http.StatusOK},
+		{"admin-token", "DELETE", "/apps/autotest/perms/friend", ``, http.StatusNoContent},
+		{"admin-token", "DELETE", "/apps/autotest/perms/friend", ``, http.StatusNotFound},
+		{"friend-token", "GET", "/apps/autotest", ``, http.StatusForbidden},
+		{testToken, "DELETE", "/apps/autotest", ``, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRecorder()
+		req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "token "+tt.token)
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("%s %s as %s: %d expected, received %d: %s", tt.method, tt.path, tt.token, tt.code, r.Code, r.Body.String())
+		}
+	}
+}
+
+func TestListAppsOnlyShowsAccessibleApps(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	for _, owner := range []string{"autotest", "someone-else"} {
+		app, _ := api.NewApp(owner+"-app", Scheduler)
+		app.Owner = owner
+		Store.CreateApp(app)
+	}
+	r := httptest.NewRecorder()
+	req, err := newRequest("GET", "/apps", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d", http.StatusOK, r.Code)
+	}
+	var listed []*api.App
+	if err := json.Unmarshal(r.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != "autotest-app" {
+		t.Errorf("expected only autotest-app to be listed, got %v", listed)
+	}
+}
+
+func TestAppDomains(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	for _, id := range []string{"autotest", "other"} {
+		app, _ := api.NewApp(id, Scheduler)
+		app.Owner = "autotest"
+		Store.CreateApp(app)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"GET", "/apps/autotest/domains", ``, http.StatusNoContent},
+		{"POST", "/apps/autotest/domains", `{"domain":"WWW.Example.com"}`, http.StatusCreated},
+		{"POST", "/apps/autotest/domains", `{"domain":"www.example.com"}`, http.StatusConflict},
+		{"POST", "/apps/other/domains", `{"domain":"www.example.com"}`, http.StatusConflict},
+		{"POST", "/apps/autotest/domains", `{"domain":"not_a_domain"}`, http.StatusBadRequest},
+		{"POST", "/apps/autotest/domains", `{"domain":"*.example.com"}`, http.StatusCreated},
+		{"GET", "/apps/autotest/domains", ``, http.StatusOK},
+		{"DELETE", "/apps/autotest/domains/www.example.com", ``, http.StatusNoContent},
+		{"DELETE", "/apps/autotest/domains/www.example.com", ``, http.StatusNotFound},
+		{"POST", "/apps/other/domains", `{"domain":"www.example.com"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRecorder()
+		req, err := newRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("%s %s %s: %d expected, received %d: %s", tt.method, tt.path, tt.body, tt.code, r.Code, r.Body.String())
+		}
+	}
+
+	app, err := Store.GetApp("autotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(app.Domains) != 1 || app.Domains[0] != "*.example.com" {
+		t.Errorf("expected autotest to keep *.example.com, got %v", app.Domains)
+	}
+	calls := Scheduler.(*fake.Scheduler).CallsTo("SetDomains")
+	if len(calls) != 4 {
+		t.Fatalf("expected the scheduler to be updated on every change, got %v", calls)
+	}
+	if last := calls[2]; last.App != "autotest" || len(last.Domains) != 1 {
+		t.Errorf("expected the removed domain to no longer be routed to autotest, got %v", last)
+	}
+}
+
+// selfSignedCert returns a PEM encoded certificate for the given domains, valid for an hour, and
+// its key.
+func selfSignedCert(t *testing.T, dnsNames ...string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func TestAppCerts(t *testing.T) {
+	defer clearDB()
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	app.AddDomain("www.example.com")
+	Store.CreateApp(app)
+
+	certPEM, keyPEM := selfSignedCert(t, "www.example.com")
+	otherPEM, otherKeyPEM := selfSignedCert(t, "www.example.org")
+	upload := func(certPEM, keyPEM string) string {
+		body, err := json.Marshal(map[string]string{"certificate": certPEM, "key": keyPEM})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"GET", "/apps/autotest/certs", ``, http.StatusNoContent},
+		{"POST", "/apps/autotest/certs", upload(otherPEM, otherKeyPEM), http.StatusBadRequest},
+		{"POST", "/apps/autotest/certs", upload(certPEM, otherKeyPEM), http.StatusBadRequest},
+		{"POST", "/apps/autotest/certs", upload(certPEM, keyPEM), http.StatusCreated},
+		{"GET", "/apps/autotest/certs", ``, http.StatusOK},
+	}
+	var r *httptest.ResponseRecorder
+	for _, tt := range tests {
+		r = httptest.NewRecorder()
+		req, err := newRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("%s %s: %d expected, received %d: %s", tt.method, tt.path, tt.code, r.Code, r.Body.String())
+		}
+	}
+	if strings.Contains(r.Body.String(), "PRIVATE KEY") {
+		t.Errorf("expected the key not to be listed, got %s", r.Body.String())
+	}
+	var certs []*api.Cert
+	if err := json.Unmarshal(r.Body.Bytes(), &certs); err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || certs[0].Name != "www-example-com" || certs[0].Expires.IsZero() {
+		t.Fatalf("expected the certificate to be listed with its expiry, got %v", certs)
+	}
+	scheduler := Scheduler.(*fake.Scheduler)
+	if calls := scheduler.CallsTo("SetCert"); len(calls) != 1 || calls[0].Cert != "www-example-com" {
+		t.Errorf("expected the certificate to be stored on the scheduler, got %v", calls)
+	}
+	if calls := scheduler.CallsTo("SetDomains"); len(calls) != 1 {
+		t.Errorf("expected the ingress to be updated with the certificate, got %v", calls)
+	}
+
+	// renewing the certificate stores the new one before the old one is removed
+	renewedPEM, renewedKeyPEM := selfSignedCert(t, "www.example.com")
+	before := len(scheduler.Calls())
+	r = httptest.NewRecorder()
+	req, err := newRequest("POST", "/apps/autotest/certs", bytes.NewBufferString(upload(renewedPEM, renewedKeyPEM)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusCreated {
+		t.Fatalf("%d CREATED expected, received %d: %s", http.StatusCreated, r.Code, r.Body.String())
+	}
+	var calls []string
+	for _, c := range scheduler.Calls()[before:] {
+		calls = append(calls, c.Method)
+	}
+	if strings.Join(calls, " ") != "SetCert SetDomains RemoveCert" {
+		t.Errorf("expected the renewed certificate to be routed before the old one is removed, got %v", calls)
+	}
+	if removed := scheduler.CallsTo("RemoveCert"); len(removed) != 1 || removed[0].Fingerprint != certs[0].Fingerprint {
+		t.Errorf("expected the old certificate to be removed, got %v", removed)
+	}
+
+	r = httptest.NewRecorder()
+	req, err = newRequest("DELETE", "/apps/autotest/certs/www-example-com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.ServeRequest(r, req)
+	if r.Code != http.StatusNoContent {
+		t.Errorf("%d NO CONTENT expected, received %d", http.StatusNoContent, r.Code)
+	}
+	if removed := scheduler.CallsTo("RemoveCert"); len(removed) != 2 || removed[1].Fingerprint == certs[0].Fingerprint {
+		t.Errorf("expected the renewed certificate to be removed from the scheduler, got %v", removed)
 	}
 }
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newHTTPServer creates a server which serves the API on the given listener.
+func newHTTPServer(addr string, l net.Listener) *HTTPServer {
+	s := &HTTPServer{l: l, stopping: make(chan struct{})}
+	s.srv = &http.Server{Addr: addr, Handler: versionHeader(s.track(createRouter()))}
+	return s
+}
+
+// stoppingKey is the context key of the channel which is closed once the server shuts down.
+const stoppingKey contextKey = 2
+
+// track keeps count of the requests in flight so that Shutdown can wait for them. Once the
+// server is shutting down, new requests are turned away. Requests in flight are left to finish,
+// except for those which would never end on their own, such as followed log streams: they watch
+// shuttingDown and end when it is closed.
+func (s *HTTPServer) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// holding the read lock orders every Add before Shutdown's Wait
+		s.mu.RLock()
+		select {
+		case <-s.stopping:
+			s.mu.RUnlock()
+			w.Header().Set("Connection", "close")
+			writeError(w, r, errShuttingDown)
+			return
+		default:
+		}
+		s.inflight.Add(1)
+		s.mu.RUnlock()
+		defer s.inflight.Done()
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stoppingKey, s.stopping)))
+	})
+}
+
+// shuttingDown returns a channel which is closed once the server starts shutting down. It is nil,
+// and so never closed, for requests which were not served by an HTTPServer.
+func shuttingDown(r *http.Request) <-chan struct{} {
+	stopping, _ := r.Context().Value(stoppingKey).(chan struct{})
+	return stopping
+}
+
+// Shutdown stops accepting connections, tells followed log streams to end and waits up to
+// timeout for the requests in flight to finish. It returns an error if some were still running
+// when the timeout expired; they are dropped once the process exits.
+func (s *HTTPServer) Shutdown(timeout time.Duration) error {
+	s.srv.SetKeepAlivesEnabled(false)
+	s.l.Close()
+	s.mu.Lock()
+	s.stopOnce.Do(func() { close(s.stopping) })
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("requests were still in flight after %v", timeout)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fishworks/api"
+	"github.com/fishworks/api/scheduler/fake"
+)
+
+func TestShutdownEndsFollowedLogs(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	Scheduler.(*fake.Scheduler).LogLines = map[string][]string{
+		"autotest": []string{"autotest-web-1: one"},
+	}
+	Scheduler.(*fake.Scheduler).KeepFollowing = true
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	req, err := newRequest("GET", "http://"+srv.l.Addr().String()+"/apps/autotest/logs?follow=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "autotest-web-1: one\n" {
+		t.Fatalf("expected the first line to be streamed, got %q (%v)", line, err)
+	}
+	if err := srv.Shutdown(5 * time.Second); err != nil {
+		t.Fatalf("expected the log stream to end on shutdown, got %v", err)
+	}
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("expected the log stream to end cleanly, got %v", err)
+	}
+}
+
+func TestShutdownLetsRequestsFinish(t *testing.T) {
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	finished := make(chan error, 1)
+	srv.srv.Handler = srv.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		finished <- r.Context().Err()
+	}))
+	go srv.ServeRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/_ping", nil))
+	<-started
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Shutdown(5 * time.Second) }()
+	<-srv.stopping
+	close(release)
+	if err := <-finished; err != nil {
+		t.Errorf("expected the request not to be canceled by the shutdown, got %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("expected shutdown to finish once the request did, got %v", err)
+	}
+}
+
+func TestShutdownTimesOut(t *testing.T) {
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	srv.srv.Handler = srv.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	go srv.ServeRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/_ping", nil))
+	<-started
+	if err := srv.Shutdown(50 * time.Millisecond); err == nil {
+		t.Error("expected shutdown to time out while a request is in flight")
+	}
+	close(release)
+	if err := srv.Shutdown(5 * time.Second); err != nil {
+		t.Errorf("expected shutdown to finish once the request did, got %v", err)
+	}
+}
+
+func TestRequestsAfterShutdown(t *testing.T) {
+	srv, err := New("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRecorder()
+	srv.ServeRequest(r, httptest.NewRequest("GET", "/_ping", nil))
+	if r.Code != http.StatusServiceUnavailable {
+		t.Errorf("%d Service Unavailable expected, received %d", http.StatusServiceUnavailable, r.Code)
+	}
+}
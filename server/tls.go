@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// TLSCertFile and TLSKeyFile are the PEM encoded certificate and key served by https listeners.
+var TLSCertFile, TLSKeyFile string
+
+// TLSClientCAFile is a PEM encoded bundle of CA certificates. When set, https listeners only
+// accept clients which present a certificate signed by one of these CAs.
+var TLSClientCAFile string
+
+// certReloader serves a certificate which can be swapped out while the listener keeps running.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload re-reads the certificate and key. If they cannot be loaded, the current certificate
+// keeps being served.
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+func setupTLSHTTP(addr string) (*HTTPServer, error) {
+	if TLSCertFile == "" || TLSKeyFile == "" {
+		return nil, fmt.Errorf("https listeners need a certificate and a key")
+	}
+	certs, err := newCertReloader(TLSCertFile, TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		GetCertificate: certs.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if TLSClientCAFile != "" {
+		bundle, err := ioutil.ReadFile(TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in %s", TLSClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newHTTPServer(addr, tls.NewListener(l, config))
+	s.srv.TLSConfig = config
+	s.certs = certs
+	return s, nil
+}
+
+// ReloadCertificate re-reads the certificate and key of an https listener without closing it.
+// New connections are served with the new certificate. Other listeners have nothing to reload.
+func (s *HTTPServer) ReloadCertificate() error {
+	if s.certs == nil {
+		return nil
+	}
+	return s.certs.reload()
+}
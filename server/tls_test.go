@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withTLSFiles writes the given certificate, key and client CA bundle to a temporary directory and
+// points the https listener settings at them for the duration of fn.
+func withTLSFiles(t *testing.T, certPEM, keyPEM, clientCAPEM string, fn func()) {
+	dir, err := ioutil.TempDir("", "api-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { TLSCertFile, TLSKeyFile, TLSClientCAFile = "", "", "" }()
+	TLSCertFile, TLSKeyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTLSFiles(t, certPEM, keyPEM)
+	if clientCAPEM != "" {
+		TLSClientCAFile = filepath.Join(dir, "ca.crt")
+		if err := ioutil.WriteFile(TLSClientCAFile, []byte(clientCAPEM), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fn()
+}
+
+func writeTLSFiles(t *testing.T, certPEM, keyPEM string) {
+	if err := ioutil.WriteFile(TLSCertFile, []byte(certPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(TLSKeyFile, []byte(keyPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pingTLS pings the server over https, trusting the given certificates, and returns the
+// certificate the server presented.
+func pingTLS(srv *HTTPServer, trusted []string, clientCerts ...tls.Certificate) (*x509.Certificate, error) {
+	roots := x509.NewCertPool()
+	for _, cert := range trusted {
+		roots.AppendCertsFromPEM([]byte(cert))
+	}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: clientCerts},
+		DisableKeepAlives: true,
+	}}
+	resp, err := client.Get("https://" + srv.l.Addr().String() + "/_ping")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0], nil
+}
+
+func TestHTTPSReloadsCertificate(t *testing.T) {
+	first, firstKey := selfSignedCert(t, "localhost")
+	second, secondKey := selfSignedCert(t, "localhost")
+	withTLSFiles(t, first, firstKey, "", func() {
+		srv, err := New("https", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+		go srv.Serve()
+
+		served, err := pingTLS(srv, []string{first, second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		firstRaw := served.Raw
+
+		// a broken certificate is not picked up
+		writeTLSFiles(t, second, firstKey)
+		if err := srv.ReloadCertificate(); err == nil {
+			t.Error("expected reloading a mismatched certificate and key to fail")
+		}
+		writeTLSFiles(t, second, secondKey)
+		if err := srv.ReloadCertificate(); err != nil {
+			t.Fatal(err)
+		}
+		served, err = pingTLS(srv, []string{first, second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(served.Raw) == string(firstRaw) {
+			t.Error("expected the reloaded certificate to be served")
+		}
+	})
+}
+
+func TestHTTPSRequiresClientCertificates(t *testing.T) {
+	serverCert, serverKey := selfSignedCert(t, "localhost")
+	clientCert, clientKey := selfSignedCert(t, "client")
+	withTLSFiles(t, serverCert, serverKey, clientCert, func() {
+		srv, err := New("https", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+		go srv.Serve()
+
+		if _, err := pingTLS(srv, []string{serverCert}); err == nil {
+			t.Error("expected clients without a certificate to be rejected")
+		}
+		pair, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pingTLS(srv, []string{serverCert}, pair); err != nil {
+			t.Errorf("expected clients with a trusted certificate to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestHTTPSNeedsACertificate(t *testing.T) {
+	if _, err := New("https", "127.0.0.1:0"); err == nil {
+		t.Error("expected an https listener without a certificate to fail")
+	}
+}
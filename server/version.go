@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/fishworks/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+// apiVersionHeader carries the API version: the server sends it on every response, and clients
+// may send it to have the server check that they speak a compatible version.
+const apiVersionHeader = "X-Deis-API-Version"
+
+// apiPrefix is the path prefix of the current API version. Every route is also served without
+// it, for clients which predate versioned paths.
+const apiPrefix = "/v1"
+
+// versionHeader sets the API version header on every response, including those which never make
+// it to a route.
+func versionHeader(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(apiVersionHeader, api.APIVersion)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// apiVersionMiddleware rejects requests from clients which speak an incompatible API version.
+// Clients which do not say which version they speak are let through.
+func apiVersionMiddleware(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if version := r.Header.Get(apiVersionHeader); version != "" {
+			if err := api.CheckAPIVersion(version); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+		h(w, r, p)
+	}
+}
+
+// getVersion responds with the version of the server and of the API it serves.
+func getVersion(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	version := map[string]string{
+		"version":     api.Version,
+		"api_version": api.APIVersion,
+	}
+	if err := WriteJSON(w, version, http.StatusOK); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fishworks/api"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+	defer clearDB()
+	app, _ := api.NewApp("autotest", Scheduler)
+	app.Owner = "autotest"
+	Store.CreateApp(app)
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	tests := []struct {
+		path    string
+		version string
+		code    int
+	}{
+		{"/v1/apps/autotest", "", http.StatusOK},
+		{"/apps/autotest", "", http.StatusOK},
+		{"/v1/_ping", "", http.StatusOK},
+		{"/v1/apps/autotest", "1.4", http.StatusOK},
+		{"/v1/apps/autotest", "2.0", http.StatusBadRequest},
+		{"/_ping", "0.9", http.StatusBadRequest},
+		{"/v2/apps/autotest", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRecorder()
+		req, err := newRequest("GET", tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.version != "" {
+			req.Header.Set("X-Deis-API-Version", tt.version)
+		}
+		srv.ServeRequest(r, req)
+		if r.Code != tt.code {
+			t.Errorf("GET %s as %s: %d expected, received %d: %s", tt.path, tt.version, tt.code, r.Code, r.Body.String())
+		}
+		if v := r.Header().Get("X-Deis-API-Version"); v != api.APIVersion {
+			t.Errorf("GET %s: expected API version %s to be sent, got %q", tt.path, api.APIVersion, v)
+		}
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	srv, err := New("tcp", "0.0.0.0:4567")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	r := httptest.NewRecorder()
+	srv.ServeRequest(r, httptest.NewRequest("GET", "/version", nil))
+	if r.Code != http.StatusOK {
+		t.Fatalf("%d OK expected, received %d", http.StatusOK, r.Code)
+	}
+	var version map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version["version"] != api.Version || version["api_version"] != api.APIVersion {
+		t.Errorf("expected version %s and API version %s, got %v", api.Version, api.APIVersion, version)
+	}
+}
@@ -2,6 +2,29 @@
 // and tune the API
 package settings
 
+import "time"
+
 var ListenAddress string
 
 var LogLevel string
+
+// StoreURL selects where apps are persisted, as driver://path. Supported drivers are
+// memory:// and bolt:///path/to/api.db.
+var StoreURL string
+
+// AdminUsername and AdminPassword are the credentials of the admin user created when the API
+// starts with no users. If AdminPassword is empty, a random password is generated and written to
+// stderr.
+var AdminUsername, AdminPassword string
+
+// TLSCert and TLSKey are the certificate and key files served when ListenAddress uses the
+// https:// (or tls://) scheme. They are reloaded on SIGHUP.
+var TLSCert, TLSKey string
+
+// TLSClientCA is a CA bundle file. When set, https clients must present a certificate signed by
+// one of its CAs.
+var TLSClientCA string
+
+// ShutdownTimeout is how long the requests in flight are given to finish once the API receives
+// SIGTERM or SIGINT.
+var ShutdownTimeout time.Duration
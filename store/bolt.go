@@ -0,0 +1,448 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/fishworks/api"
+)
+
+var (
+	appsBucket     = []byte("apps")
+	appKey         = []byte("app")
+	buildsBucket   = []byte("builds")
+	configsBucket  = []byte("configs")
+	releasesBucket = []byte("releases")
+	usersBucket    = []byte("users")
+	tokensBucket   = []byte("tokens")
+)
+
+// appRecord is the on-disk representation of an app. It exists because api.App hides some of
+// its fields (such as the UUID) from JSON. Certificates are stored without their key, which only
+// the scheduler keeps.
+type appRecord struct {
+	UUID          string         `json:"uuid"`
+	ID            string         `json:"id"`
+	Created       time.Time      `json:"created"`
+	Updated       time.Time      `json:"updated"`
+	Structure     map[string]int `json:"structure"`
+	Owner         string         `json:"owner"`
+	Collaborators []string       `json:"collaborators"`
+	Domains       []string       `json:"domains"`
+	Certs         []*api.Cert    `json:"certs"`
+}
+
+// userRecord is the on-disk representation of a user, which keeps the credentials api.User hides
+// from JSON.
+type userRecord struct {
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"password_hash"`
+	Token        string    `json:"token"`
+	Admin        bool      `json:"admin"`
+	Created      time.Time `json:"created"`
+}
+
+// BoltStore persists everything to a single BoltDB file.
+//
+// Every app gets its own bucket inside the "apps" bucket, holding the app record along with
+// nested buckets for its builds, configs and releases. Deleting an app is then a matter of
+// deleting its bucket. Users are kept in the "users" bucket by username, and the "tokens" bucket
+// maps every API token to its user.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the BoltDB database at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{appsBucket, usersBucket, tokensBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Apps returns every app in the store.
+func (s *BoltStore) Apps() ([]*api.App, error) {
+	var apps []*api.App
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(appsBucket).ForEach(func(k, v []byte) error {
+			app, err := loadApp(tx.Bucket(appsBucket).Bucket(k))
+			if err != nil {
+				return err
+			}
+			apps = append(apps, app)
+			return nil
+		})
+	})
+	return apps, err
+}
+
+// CountApps returns the number of apps in the store.
+func (s *BoltStore) CountApps() (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(appsBucket).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// GetApp returns the app with the given ID.
+func (s *BoltStore) GetApp(id string) (*api.App, error) {
+	var app *api.App
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(appsBucket).Bucket([]byte(id))
+		if b == nil {
+			return ErrAppNotFound
+		}
+		var err error
+		app, err = loadApp(b)
+		return err
+	})
+	return app, err
+}
+
+// CreateApp adds a new app to the store along with every release in its ledger.
+func (s *BoltStore) CreateApp(app *api.App) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		apps := tx.Bucket(appsBucket)
+		if apps.Bucket([]byte(app.ID)) != nil {
+			return ErrAppExists
+		}
+		b, err := apps.CreateBucket([]byte(app.ID))
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{buildsBucket, configsBucket, releasesBucket} {
+			if _, err := b.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		if err := putApp(b, app); err != nil {
+			return err
+		}
+		for _, release := range app.Ledger {
+			if err := putRelease(b, release); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateApp saves the app's attributes.
+func (s *BoltStore) UpdateApp(app *api.App) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(appsBucket).Bucket([]byte(app.ID))
+		if b == nil {
+			return ErrAppNotFound
+		}
+		return putApp(b, app)
+	})
+}
+
+// DeleteApp removes the app along with its builds, configs and releases.
+func (s *BoltStore) DeleteApp(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(appsBucket).DeleteBucket([]byte(id)); err != nil {
+			if err == bolt.ErrBucketNotFound {
+				return ErrAppNotFound
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// Builds returns every build for the given app.
+func (s *BoltStore) Builds(appID string) ([]*api.Build, error) {
+	app, err := s.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	var builds []*api.Build
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(appsBucket).Bucket([]byte(appID)).Bucket(buildsBucket).ForEach(func(k, v []byte) error {
+			build := &api.Build{App: app}
+			if err := json.Unmarshal(v, build); err != nil {
+				return err
+			}
+			builds = append(builds, build)
+			return nil
+		})
+	})
+	return builds, err
+}
+
+// AddBuild saves a build for the app it is attached to.
+func (s *BoltStore) AddBuild(build *api.Build) error {
+	if build.App == nil {
+		return ErrNoApp
+	}
+	return s.appendTo(build.App.ID, buildsBucket, build)
+}
+
+// Configs returns every config for the given app.
+func (s *BoltStore) Configs(appID string) ([]*api.Config, error) {
+	app, err := s.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	var configs []*api.Config
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(appsBucket).Bucket([]byte(appID)).Bucket(configsBucket).ForEach(func(k, v []byte) error {
+			config := &api.Config{App: app}
+			if err := json.Unmarshal(v, config); err != nil {
+				return err
+			}
+			configs = append(configs, config)
+			return nil
+		})
+	})
+	return configs, err
+}
+
+// AddConfig saves a config for the app it is attached to.
+func (s *BoltStore) AddConfig(config *api.Config) error {
+	if config.App == nil {
+		return ErrNoApp
+	}
+	return s.appendTo(config.App.ID, configsBucket, config)
+}
+
+// Releases returns the release ledger for the given app.
+func (s *BoltStore) Releases(appID string) ([]*api.Release, error) {
+	app, err := s.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	return app.Ledger, nil
+}
+
+// AddRelease appends a release to the ledger of the app it is attached to.
+func (s *BoltStore) AddRelease(release *api.Release) error {
+	if release.App == nil {
+		return ErrNoApp
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(appsBucket).Bucket([]byte(release.App.ID))
+		if b == nil {
+			return ErrAppNotFound
+		}
+		if k, _ := b.Bucket(releasesBucket).Cursor().Last(); k != nil && release.Version != btoi(k)+1 {
+			return ErrVersionConflict
+		}
+		return putRelease(b, release)
+	})
+}
+
+// Users returns every user account.
+func (s *BoltStore) Users() ([]*api.User, error) {
+	var users []*api.User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			user, err := loadUser(v)
+			if err != nil {
+				return err
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	return users, err
+}
+
+// GetUser returns the user with the given username.
+func (s *BoltStore) GetUser(username string) (*api.User, error) {
+	var user *api.User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(usersBucket).Get([]byte(username))
+		if v == nil {
+			return ErrUserNotFound
+		}
+		var err error
+		user, err = loadUser(v)
+		return err
+	})
+	return user, err
+}
+
+// GetUserByToken returns the user holding the given API token.
+func (s *BoltStore) GetUserByToken(token string) (*api.User, error) {
+	if token == "" {
+		return nil, ErrUserNotFound
+	}
+	var user *api.User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		username := tx.Bucket(tokensBucket).Get([]byte(token))
+		if username == nil {
+			return ErrUserNotFound
+		}
+		v := tx.Bucket(usersBucket).Get(username)
+		if v == nil {
+			return ErrUserNotFound
+		}
+		var err error
+		user, err = loadUser(v)
+		return err
+	})
+	return user, err
+}
+
+// CreateUser adds a new user account to the store.
+func (s *BoltStore) CreateUser(user *api.User) error {
+	data, err := json.Marshal(userRecord{
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Token:        user.Token,
+		Admin:        user.Admin,
+		Created:      user.Created,
+	})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+		if users.Get([]byte(user.Username)) != nil {
+			return ErrUserExists
+		}
+		if err := users.Put([]byte(user.Username), data); err != nil {
+			return err
+		}
+		if user.Token == "" {
+			return nil
+		}
+		return tx.Bucket(tokensBucket).Put([]byte(user.Token), []byte(user.Username))
+	})
+}
+
+// Close closes the underlying database file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// appendTo stores v as JSON under the next sequence number of the named bucket of an app.
+func (s *BoltStore) appendTo(appID string, bucket []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(appsBucket).Bucket([]byte(appID))
+		if b == nil {
+			return ErrAppNotFound
+		}
+		b = b.Bucket(bucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(int(seq)), data)
+	})
+}
+
+func putApp(b *bolt.Bucket, app *api.App) error {
+	data, err := json.Marshal(appRecord{
+		UUID:          app.UUID,
+		ID:            app.ID,
+		Created:       app.Created,
+		Updated:       app.Updated,
+		Structure:     app.Structure,
+		Owner:         app.Owner,
+		Collaborators: app.Collaborators,
+		Domains:       app.Domains,
+		Certs:         app.Certs,
+	})
+	if err != nil {
+		return err
+	}
+	return b.Put(appKey, data)
+}
+
+func putRelease(b *bolt.Bucket, release *api.Release) error {
+	data, err := json.Marshal(release)
+	if err != nil {
+		return err
+	}
+	return b.Bucket(releasesBucket).Put(itob(release.Version), data)
+}
+
+// loadApp reads an app and its release ledger out of the app's bucket.
+func loadApp(b *bolt.Bucket) (*api.App, error) {
+	var rec appRecord
+	if err := json.Unmarshal(b.Get(appKey), &rec); err != nil {
+		return nil, err
+	}
+	app := &api.App{
+		UUID:          rec.UUID,
+		ID:            rec.ID,
+		Created:       rec.Created,
+		Updated:       rec.Updated,
+		Structure:     rec.Structure,
+		Owner:         rec.Owner,
+		Collaborators: rec.Collaborators,
+		Domains:       rec.Domains,
+		Certs:         rec.Certs,
+	}
+	err := b.Bucket(releasesBucket).ForEach(func(k, v []byte) error {
+		release := &api.Release{App: app}
+		if err := json.Unmarshal(v, release); err != nil {
+			return err
+		}
+		if release.Build != nil {
+			release.Build.App = app
+		}
+		if release.Config != nil {
+			release.Config.App = app
+		}
+		app.Ledger = append(app.Ledger, release)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func loadUser(data []byte) (*api.User, error) {
+	var rec userRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &api.User{
+		Username:     rec.Username,
+		PasswordHash: rec.PasswordHash,
+		Token:        rec.Token,
+		Admin:        rec.Admin,
+		Created:      rec.Created,
+	}, nil
+}
+
+// btoi decodes a key encoded by itob.
+func btoi(b []byte) int {
+	return int(binary.BigEndian.Uint64(b))
+}
+
+// itob encodes v as an 8-byte big endian key so that keys sort in numerical order.
+func itob(v int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
@@ -0,0 +1,283 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/fishworks/api"
+)
+
+// MemoryStore keeps everything in process memory. Its contents are lost when the process exits.
+//
+// Like the on-disk stores, MemoryStore hands out copies of the apps it stores, so changes made to
+// an app are not visible to other readers until they are saved. Builds, configs and releases are
+// immutable and are shared.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	apps    []*api.App
+	builds  []*api.Build
+	configs []*api.Config
+	users   []*api.User
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Apps returns every app in the store.
+func (s *MemoryStore) Apps() ([]*api.App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	apps := make([]*api.App, len(s.apps))
+	for i, app := range s.apps {
+		apps[i] = copyApp(app)
+	}
+	return apps, nil
+}
+
+// CountApps returns the number of apps in the store.
+func (s *MemoryStore) CountApps() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.apps), nil
+}
+
+// GetApp returns the app with the given ID.
+func (s *MemoryStore) GetApp(id string) (*api.App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := s.indexOf(id); i >= 0 {
+		return copyApp(s.apps[i]), nil
+	}
+	return nil, ErrAppNotFound
+}
+
+// CreateApp adds a new app to the store.
+func (s *MemoryStore) CreateApp(app *api.App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexOf(app.ID) >= 0 {
+		return ErrAppExists
+	}
+	s.apps = append(s.apps, copyApp(app))
+	return nil
+}
+
+// UpdateApp saves the app's attributes, keeping the stored ledger.
+func (s *MemoryStore) UpdateApp(app *api.App) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(app.ID)
+	if i < 0 {
+		return ErrAppNotFound
+	}
+	updated := copyApp(app)
+	updated.Ledger = s.apps[i].Ledger
+	s.apps[i] = updated
+	return nil
+}
+
+// DeleteApp removes the app along with its builds and configs.
+func (s *MemoryStore) DeleteApp(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(id)
+	if i < 0 {
+		return ErrAppNotFound
+	}
+	s.apps = append(s.apps[:i], s.apps[i+1:]...)
+
+	var builds []*api.Build
+	for _, build := range s.builds {
+		if build.App.ID != id {
+			builds = append(builds, build)
+		}
+	}
+	s.builds = builds
+
+	var configs []*api.Config
+	for _, config := range s.configs {
+		if config.App.ID != id {
+			configs = append(configs, config)
+		}
+	}
+	s.configs = configs
+	return nil
+}
+
+// Builds returns every build for the given app.
+func (s *MemoryStore) Builds(appID string) ([]*api.Build, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.indexOf(appID) < 0 {
+		return nil, ErrAppNotFound
+	}
+	var builds []*api.Build
+	for _, build := range s.builds {
+		if build.App.ID == appID {
+			builds = append(builds, build)
+		}
+	}
+	return builds, nil
+}
+
+// AddBuild saves a build for the app it is attached to.
+func (s *MemoryStore) AddBuild(build *api.Build) error {
+	if build.App == nil {
+		return ErrNoApp
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexOf(build.App.ID) < 0 {
+		return ErrAppNotFound
+	}
+	s.builds = append(s.builds, build)
+	return nil
+}
+
+// Configs returns every config for the given app.
+func (s *MemoryStore) Configs(appID string) ([]*api.Config, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.indexOf(appID) < 0 {
+		return nil, ErrAppNotFound
+	}
+	var configs []*api.Config
+	for _, config := range s.configs {
+		if config.App.ID == appID {
+			configs = append(configs, config)
+		}
+	}
+	return configs, nil
+}
+
+// AddConfig saves a config for the app it is attached to.
+func (s *MemoryStore) AddConfig(config *api.Config) error {
+	if config.App == nil {
+		return ErrNoApp
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexOf(config.App.ID) < 0 {
+		return ErrAppNotFound
+	}
+	s.configs = append(s.configs, config)
+	return nil
+}
+
+// Releases returns the release ledger for the given app.
+func (s *MemoryStore) Releases(appID string) ([]*api.Release, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.indexOf(appID)
+	if i < 0 {
+		return nil, ErrAppNotFound
+	}
+	releases := make([]*api.Release, len(s.apps[i].Ledger))
+	copy(releases, s.apps[i].Ledger)
+	return releases, nil
+}
+
+// AddRelease appends the release to its app's ledger.
+func (s *MemoryStore) AddRelease(release *api.Release) error {
+	if release.App == nil {
+		return ErrNoApp
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(release.App.ID)
+	if i < 0 {
+		return ErrAppNotFound
+	}
+	app := s.apps[i]
+	if latest := app.LatestRelease(); latest != nil && release.Version != latest.Version+1 {
+		return ErrVersionConflict
+	}
+	app.Ledger = append(app.Ledger, release)
+	return nil
+}
+
+// Users returns every user account.
+func (s *MemoryStore) Users() ([]*api.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]*api.User, len(s.users))
+	for i, user := range s.users {
+		u := *user
+		users[i] = &u
+	}
+	return users, nil
+}
+
+// GetUser returns the user with the given username.
+func (s *MemoryStore) GetUser(username string) (*api.User, error) {
+	return s.findUser(func(u *api.User) bool { return u.Username == username })
+}
+
+// GetUserByToken returns the user holding the given API token.
+func (s *MemoryStore) GetUserByToken(token string) (*api.User, error) {
+	if token == "" {
+		return nil, ErrUserNotFound
+	}
+	return s.findUser(func(u *api.User) bool { return u.Token == token })
+}
+
+// CreateUser adds a new user account to the store.
+func (s *MemoryStore) CreateUser(user *api.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == user.Username {
+			return ErrUserExists
+		}
+	}
+	u := *user
+	s.users = append(s.users, &u)
+	return nil
+}
+
+func (s *MemoryStore) findUser(match func(*api.User) bool) (*api.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, user := range s.users {
+		if match(user) {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// Close is a no-op for the in-memory store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// copyApp copies an app along with its ledger, structure, collaborators, domains and certs, so
+// that the copy can be changed without affecting the original.
+func copyApp(app *api.App) *api.App {
+	c := *app
+	c.Ledger = nil
+	for _, release := range app.Ledger {
+		c.Ledger = append(c.Ledger, release)
+	}
+	if app.Structure != nil {
+		c.Structure = make(map[string]int, len(app.Structure))
+		for typ, n := range app.Structure {
+			c.Structure[typ] = n
+		}
+	}
+	c.Collaborators = append([]string(nil), app.Collaborators...)
+	c.Domains = append([]string(nil), app.Domains...)
+	c.Certs = append([]*api.Cert(nil), app.Certs...)
+	return &c
+}
+
+func (s *MemoryStore) indexOf(id string) int {
+	for i, app := range s.apps {
+		if app.ID == id {
+			return i
+		}
+	}
+	return -1
+}
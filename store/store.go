@@ -0,0 +1,90 @@
+// Package store persists applications along with their builds, configs and release ledger, as
+// well as user accounts, so they survive a restart of the API.
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fishworks/api"
+)
+
+var (
+	// ErrAppNotFound is returned when the requested app does not exist in the store.
+	ErrAppNotFound = errors.New("app not found")
+	// ErrAppExists is returned when creating an app whose ID is already taken.
+	ErrAppExists = errors.New("app already exists")
+	// ErrNoApp is returned when adding a build, config or release which is not attached to an app.
+	ErrNoApp = errors.New("record is not attached to an app")
+	// ErrVersionConflict is returned when adding a release whose version does not directly follow
+	// the latest release in the ledger, which means the ledger changed since the app was loaded.
+	ErrVersionConflict = errors.New("release version conflicts with the ledger")
+	// ErrUserNotFound is returned when the requested user does not exist in the store.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user whose username is already taken.
+	ErrUserExists = errors.New("user already exists")
+)
+
+// Store is the persistence layer for apps and everything attached to them.
+//
+// Apps returned from the store have their release ledger populated, and every build, config
+// and release returned from the store points back to its app. Apps are returned by value: changes
+// to them are only visible to other readers once they are saved through the store.
+//
+// Stores are safe for concurrent use, but they do not serialize read-modify-write sequences such
+// as loading an app, appending a release and saving it; callers are expected to lock the app.
+type Store interface {
+	// Apps returns every app in the store.
+	Apps() ([]*api.App, error)
+	// CountApps returns the number of apps in the store, without loading them.
+	CountApps() (int, error)
+	// GetApp returns the app with the given ID, or ErrAppNotFound.
+	GetApp(id string) (*api.App, error)
+	// CreateApp adds a new app to the store along with every release in its ledger.
+	CreateApp(app *api.App) error
+	// UpdateApp saves the app's attributes. It does not touch the app's ledger.
+	UpdateApp(app *api.App) error
+	// DeleteApp removes the app along with its builds, configs and releases.
+	DeleteApp(id string) error
+
+	// Builds returns every build for the given app, oldest first.
+	Builds(appID string) ([]*api.Build, error)
+	// AddBuild saves a build for the app it is attached to.
+	AddBuild(build *api.Build) error
+
+	// Configs returns every config for the given app, oldest first.
+	Configs(appID string) ([]*api.Config, error)
+	// AddConfig saves a config for the app it is attached to.
+	AddConfig(config *api.Config) error
+
+	// Releases returns the release ledger for the given app, ordered by version.
+	Releases(appID string) ([]*api.Release, error)
+	// AddRelease appends a release to the ledger of the app it is attached to. It returns
+	// ErrVersionConflict unless the release directly follows the latest release in the ledger.
+	AddRelease(release *api.Release) error
+
+	// Users returns every user account.
+	Users() ([]*api.User, error)
+	// GetUser returns the user with the given username, or ErrUserNotFound.
+	GetUser(username string) (*api.User, error)
+	// GetUserByToken returns the user holding the given API token, or ErrUserNotFound.
+	GetUserByToken(token string) (*api.User, error)
+	// CreateUser adds a new user account to the store.
+	CreateUser(user *api.User) error
+
+	// Close flushes and releases any resources held by the store.
+	Close() error
+}
+
+// New creates a store for the given driver. The "memory" driver ignores path; the "bolt" driver
+// opens (or creates) a database file at path.
+func New(driver, path string) (Store, error) {
+	switch driver {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "bolt":
+		return NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fishworks/api"
+)
+
+// withStores runs fn against every store implementation.
+func withStores(t *testing.T, fn func(t *testing.T, s Store)) {
+	fn(t, NewMemoryStore())
+
+	dir, err := ioutil.TempDir("", "api-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewBoltStore(filepath.Join(dir, "api.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	fn(t, s)
+}
+
+func newApp(id string) *api.App {
+	app := &api.App{
+		UUID:    "4e8ef8c6-8fd4-4a39-ab7a-0e3d16d3ef7e",
+		ID:      id,
+		Created: time.Now().UTC(),
+		Updated: time.Now().UTC(),
+		Owner:   "autotest",
+	}
+	app.Collaborators = []string{"friend"}
+	app.Domains = []string{"www.example.com"}
+	app.Certs = []*api.Cert{{Name: "www-example-com", Domains: app.Domains}}
+	app.Ledger = append(app.Ledger, &api.Release{App: app, Version: 1})
+	return app
+}
+
+func TestCreateAndGetApp(t *testing.T) {
+	withStores(t, func(t *testing.T, s Store) {
+		if err := s.CreateApp(newApp("autotest")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateApp(newApp("autotest")); err != ErrAppExists {
+			t.Errorf("expected ErrAppExists when creating a duplicate app, got %v", err)
+		}
+		app, err := s.GetApp("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app.UUID == "" {
+			t.Error("expected UUID to be stored")
+		}
+		if app.Ledger.Len() != 1 {
+			t.Errorf("expected the initial release to be stored; got %d releases", app.Ledger.Len())
+		}
+		if app.Owner != "autotest" || len(app.Collaborators) != 1 || app.Collaborators[0] != "friend" {
+			t.Errorf("expected owner and collaborators to be stored, got %s and %v", app.Owner, app.Collaborators)
+		}
+		if len(app.Domains) != 1 || app.Domains[0] != "www.example.com" {
+			t.Errorf("expected domains to be stored, got %v", app.Domains)
+		}
+		if len(app.Certs) != 1 || app.Certs[0].Name != "www-example-com" {
+			t.Errorf("expected certs to be stored, got %v", app.Certs)
+		}
+		if _, err := s.GetApp("nope"); err != ErrAppNotFound {
+			t.Errorf("expected ErrAppNotFound, got %v", err)
+		}
+		apps, err := s.Apps()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(apps) != 1 {
+			t.Errorf("expected 1 app, got %d", len(apps))
+		}
+		if n, err := s.CountApps(); err != nil || n != 1 {
+			t.Errorf("expected a count of 1 app, got %d (%v)", n, err)
+		}
+	})
+}
+
+func TestBuildsConfigsAndReleases(t *testing.T) {
+	withStores(t, func(t *testing.T, s Store) {
+		if err := s.CreateApp(newApp("autotest")); err != nil {
+			t.Fatal(err)
+		}
+		app, err := s.GetApp("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		build := &api.Build{App: app, Image: "deis/example-go:latest"}
+		if err := s.AddBuild(build); err != nil {
+			t.Fatal(err)
+		}
+		config := &api.Config{App: app}
+		if err := s.AddConfig(config); err != nil {
+			t.Fatal(err)
+		}
+		release := app.NewRelease(build, config)
+		release.Limits = api.Limits{"web": {MemoryLimit: "512Mi"}}
+		if err := s.AddRelease(release); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddBuild(&api.Build{}); err != ErrNoApp {
+			t.Errorf("expected ErrNoApp for a detached build, got %v", err)
+		}
+
+		builds, err := s.Builds("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(builds) != 1 || builds[0].Image != build.Image {
+			t.Errorf("expected build %s to be stored, got %v", build.Image, builds)
+		}
+		configs, err := s.Configs("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(configs) != 1 {
+			t.Errorf("expected 1 config, got %d", len(configs))
+		}
+		releases, err := s.Releases("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(releases) != 2 {
+			t.Fatalf("expected 2 releases, got %d", len(releases))
+		}
+		if releases[1].Version != 2 || releases[1].Build.Image != build.Image {
+			t.Errorf("expected v2 to be released with %s, got v%d", build.Image, releases[1].Version)
+		}
+		if releases[1].App.ID != "autotest" {
+			t.Errorf("expected release to be attached to its app")
+		}
+		if releases[1].Limits["web"].MemoryLimit != "512Mi" {
+			t.Errorf("expected the release's limits to be stored, got %v", releases[1].Limits)
+		}
+	})
+}
+
+func TestDeleteApp(t *testing.T) {
+	withStores(t, func(t *testing.T, s Store) {
+		app := newApp("autotest")
+		if err := s.CreateApp(app); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddBuild(&api.Build{App: app}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddConfig(&api.Config{App: app}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddRelease(app.NewRelease(nil, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeleteApp("autotest"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DeleteApp("autotest"); err != ErrAppNotFound {
+			t.Errorf("expected ErrAppNotFound when deleting twice, got %v", err)
+		}
+		// re-creating the app must not resurrect its builds
+		if err := s.CreateApp(newApp("autotest")); err != nil {
+			t.Fatal(err)
+		}
+		builds, err := s.Builds("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(builds) != 0 {
+			t.Errorf("expected builds to be purged with the app, got %d", len(builds))
+		}
+		configs, err := s.Configs("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(configs) != 0 {
+			t.Errorf("expected configs to be purged with the app, got %d", len(configs))
+		}
+		releases, err := s.Releases("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(releases) != 1 {
+			t.Errorf("expected only the new app's initial release, got %d", len(releases))
+		}
+	})
+}
+
+func TestBoltStorePersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.db")
+
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateApp(newApp("autotest")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.GetApp("autotest"); err != nil {
+		t.Errorf("expected app to survive re-opening the store, got %v", err)
+	}
+}
+
+func TestAddReleaseRejectsVersionConflicts(t *testing.T) {
+	withStores(t, func(t *testing.T, s Store) {
+		if err := s.CreateApp(newApp("autotest")); err != nil {
+			t.Fatal(err)
+		}
+		// two writers load the same app and both try to release v2
+		first, err := s.GetApp("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := s.GetApp("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddRelease(first.NewRelease(nil, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddRelease(second.NewRelease(nil, nil)); err != ErrVersionConflict {
+			t.Errorf("expected ErrVersionConflict, got %v", err)
+		}
+		releases, err := s.Releases("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(releases) != 2 {
+			t.Errorf("expected 2 releases, got %d", len(releases))
+		}
+	})
+}
+
+func TestCreateAndGetUser(t *testing.T) {
+	withStores(t, func(t *testing.T, s Store) {
+		user := &api.User{
+			Username:     "autotest",
+			PasswordHash: []byte("hash"),
+			Token:        "abc123",
+			Admin:        true,
+			Created:      time.Now().UTC(),
+		}
+		if err := s.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateUser(user); err != ErrUserExists {
+			t.Errorf("expected ErrUserExists when creating a duplicate user, got %v", err)
+		}
+		got, err := s.GetUser("autotest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.PasswordHash) != "hash" || got.Token != "abc123" || !got.Admin {
+			t.Errorf("expected the user's credentials to be stored, got %+v", got)
+		}
+		got, err = s.GetUserByToken("abc123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Username != "autotest" {
+			t.Errorf("expected token to belong to autotest, got %s", got.Username)
+		}
+		if _, err := s.GetUserByToken("nope"); err != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound for an unknown token, got %v", err)
+		}
+		if _, err := s.GetUserByToken(""); err != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound for an empty token, got %v", err)
+		}
+		if _, err := s.GetUser("nope"); err != ErrUserNotFound {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+		users, err := s.Users()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 {
+			t.Errorf("expected 1 user, got %d", len(users))
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var usernameRegexp = regexp.MustCompile(`^[a-zA-Z0-9@.+_-]+$`)
+
+// User is an account which is allowed to use the API.
+type User struct {
+	Username string `json:"username"`
+	// PasswordHash is the bcrypt hash of the user's password. The password itself is never stored.
+	PasswordHash []byte `json:"-"`
+	// Token is the API token the user authenticates with. It is handed out on login.
+	Token string `json:"-"`
+	// Admin users are allowed to manage every app.
+	Admin   bool      `json:"admin"`
+	Created time.Time `json:"created"`
+}
+
+// UserError is returned when a user cannot be created with the given credentials.
+type UserError struct {
+	Message string
+}
+
+func (e *UserError) Error() string {
+	return fmt.Sprintf("invalid user: %s", e.Message)
+}
+
+// NewUser creates a user with the given credentials along with a fresh API token.
+func NewUser(username, password string, admin bool) (*User, error) {
+	if !usernameRegexp.MatchString(username) {
+		return nil, &UserError{"username may only contain letters, digits and @.+-_"}
+	}
+	if password == "" {
+		return nil, &UserError{"password cannot be empty"}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		Username:     username,
+		PasswordHash: hash,
+		Token:        token,
+		Admin:        admin,
+		Created:      time.Now(),
+	}, nil
+}
+
+// CheckPassword reports whether password is the user's password.
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) == nil
+}
+
+func (u *User) String() string {
+	return u.Username
+}
+
+// GenerateToken returns a random, hex-encoded token suitable for API tokens and passwords.
+func GenerateToken() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
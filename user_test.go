@@ -0,0 +1,46 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/fishworks/api"
+)
+
+func TestNewUser(t *testing.T) {
+	user, err := api.NewUser("autotest", "s3cr3t", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Token == "" {
+		t.Error("expected a token to be generated")
+	}
+	if string(user.PasswordHash) == "s3cr3t" {
+		t.Error("expected the password to be hashed")
+	}
+	if !user.CheckPassword("s3cr3t") {
+		t.Error("expected the password to match")
+	}
+	if user.CheckPassword("nope") {
+		t.Error("expected a wrong password not to match")
+	}
+
+	other, err := api.NewUser("other", "s3cr3t", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Token == user.Token {
+		t.Error("expected every user to get a different token")
+	}
+}
+
+func TestNewUserRejectsInvalidCredentials(t *testing.T) {
+	if _, err := api.NewUser("auto test", "s3cr3t", false); err == nil {
+		t.Error("expected a username with spaces to be rejected")
+	}
+	if _, err := api.NewUser("", "s3cr3t", false); err == nil {
+		t.Error("expected an empty username to be rejected")
+	}
+	if _, err := api.NewUser("autotest", "", false); err == nil {
+		t.Error("expected an empty password to be rejected")
+	}
+}
@@ -1,4 +1,36 @@
 package api
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Version references the api's current version. This version must be semver-compatible.
 const Version = "0.1.0-dev"
+
+// APIVersion is the version of the REST API, which is served under /v1. Its major version only
+// changes when the API changes in a way which breaks existing clients.
+const APIVersion = "1.0"
+
+// VersionError is returned when a client speaks an API version which the server does not.
+type VersionError struct {
+	ClientVersion string
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("client API version %s is not compatible with server API version %s", e.ClientVersion, APIVersion)
+}
+
+// CheckAPIVersion checks that a client speaking the given API version, such as "1.2", can talk to
+// this server. Clients are compatible as long as their major version is the same as the server's.
+func CheckAPIVersion(clientVersion string) error {
+	if majorVersion(clientVersion) != majorVersion(APIVersion) {
+		return &VersionError{clientVersion}
+	}
+	return nil
+}
+
+// majorVersion returns the major version of a version such as "1.2".
+func majorVersion(version string) string {
+	return strings.SplitN(version, ".", 2)[0]
+}
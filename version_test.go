@@ -0,0 +1,20 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/fishworks/api"
+)
+
+func TestCheckAPIVersion(t *testing.T) {
+	for _, v := range []string{"1", "1.0", "1.9", "1.2.3"} {
+		if err := api.CheckAPIVersion(v); err != nil {
+			t.Errorf("expected API version %s to be compatible, got %v", v, err)
+		}
+	}
+	for _, v := range []string{"", "0.9", "2.0", "10", "v1", "1x"} {
+		if err := api.CheckAPIVersion(v); err == nil {
+			t.Errorf("expected API version %q to be incompatible", v)
+		}
+	}
+}